@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultAliasesPath = "~/.gonote/aliases.json"
+	minKeyPrefixLength = 4 // Shorter prefixes are too likely to be ambiguous
+)
+
+// aliasTable maps short handles to note keys, so notes can be referenced
+// without typing whole key. Every note gets numeric handle when first shown,
+// user can also set mnemonic ones. All the methods are safe to call on nil table.
+type aliasTable struct {
+	Path    string            `json:"-"`
+	Next    int               `json:"next"`    // Next numeric handle to be given
+	Aliases map[string]string `json:"aliases"` // Maps aliases to note keys
+	loaded  bool
+	dirty   bool
+}
+
+// newAliasTable returns alias table saved in given file.
+func newAliasTable(path string) *aliasTable {
+	return &aliasTable{
+		Path:    path,
+		Next:    1,
+		Aliases: make(map[string]string),
+	}
+}
+
+// load reads alias table from disk once, missing file means empty table.
+func (a *aliasTable) load() error {
+	if a.loaded {
+		return nil
+	}
+	data, err := ioutil.ReadFile(a.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err = json.Unmarshal(data, a); err != nil {
+			return err
+		}
+	}
+	a.loaded = true
+	return nil
+}
+
+// Save writes alias table to disk if it changed.
+func (a *aliasTable) Save() error {
+	if a == nil || !a.dirty {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(a.Path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(a, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := a.Path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	a.dirty = false
+	return os.Rename(tmp, a.Path)
+}
+
+// Lookup returns key of the note with given alias.
+func (a *aliasTable) Lookup(alias string) (string, bool) {
+	if a == nil || a.load() != nil {
+		return "", false
+	}
+	key, ok := a.Aliases[alias]
+	return key, ok
+}
+
+// Handle returns numeric handle of the note, giving it new one if it has none yet.
+func (a *aliasTable) Handle(key string) string {
+	if a == nil || a.load() != nil || key == "" {
+		return ""
+	}
+	for _, alias := range a.For(key) {
+		if _, err := strconv.Atoi(alias); err == nil {
+			return alias
+		}
+	}
+	alias := strconv.Itoa(a.Next)
+	a.Next++
+	a.Aliases[alias] = key
+	a.dirty = true
+	return alias
+}
+
+// For returns all aliases of the note, sorted.
+func (a *aliasTable) For(key string) []string {
+	aliases := []string{}
+	if a == nil || a.load() != nil {
+		return aliases
+	}
+	for alias, k := range a.Aliases {
+		if k == key {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// Named returns all aliases set by the user, leaving out numeric handles, sorted.
+func (a *aliasTable) Named() []string {
+	aliases := []string{}
+	if a == nil || a.load() != nil {
+		return aliases
+	}
+	for alias := range a.Aliases {
+		if _, err := strconv.Atoi(alias); err != nil {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// Set gives the note mnemonic alias, replacing previous owner of the alias.
+func (a *aliasTable) Set(alias, key string) error {
+	if err := a.load(); err != nil {
+		return err
+	}
+	if _, err := strconv.Atoi(alias); err == nil {
+		return errors.New("Numeric aliases are given automatically, choose alias containing letters.")
+	}
+	if strings.ContainsAny(alias, " \t") || strings.HasPrefix(alias, tagPrefix) || strings.HasPrefix(alias, "-") {
+		return errors.New(fmt.Sprintf("Invalid alias: %s", alias))
+	}
+	a.Aliases[alias] = key
+	a.dirty = true
+	return nil
+}
+
+// Remove drops all aliases of the note.
+func (a *aliasTable) Remove(key string) error {
+	if a == nil {
+		return nil
+	}
+	if err := a.load(); err != nil {
+		return err
+	}
+	for alias, k := range a.Aliases {
+		if k == key {
+			delete(a.Aliases, alias)
+			a.dirty = true
+		}
+	}
+	return nil
+}
+
+// ResolveKey returns full note key for key, alias or unique key prefix passed by the user.
+// Prefixes are looked up in the search index, listing the store only when nothing there matches.
+func (s *simpleNoteClient) resolveKey(ref string) (string, error) {
+	if key, ok := s.Aliases.Lookup(ref); ok {
+		return key, nil
+	}
+	if len(ref) == SimpleNoteKeyLength {
+		return ref, nil
+	}
+	if len(ref) < minKeyPrefixLength {
+		return "", notFoundError(fmt.Sprintf("Unknown note alias: %s", ref))
+	}
+	matching := matchingKeys(s.Index.All(), ref)
+	if len(matching) == 0 {
+		// Note may have been created elsewhere since it was indexed, so the store is asked as well.
+		keys, err := s.storeEntries()
+		if err != nil && !IsNetworkError(err) {
+			return "", err
+		}
+		matching = matchingKeys(keys, ref)
+	}
+	switch len(matching) {
+	case 0:
+		return "", notFoundError(fmt.Sprintf("No note matching key prefix: %s", ref))
+	case 1:
+		return matching[0], nil
+	}
+	return "", errors.New(fmt.Sprintf("Key prefix %s is ambiguous, it matches %d notes.", ref, len(matching)))
+}
+
+// matchingKeys returns keys of the notes starting with given prefix.
+func matchingKeys(notes Notes, prefix string) []string {
+	matching := []string{}
+	for _, n := range notes {
+		if strings.HasPrefix(n.Key, prefix) {
+			matching = append(matching, n.Key)
+		}
+	}
+	return matching
+}
+
+// storeEntries returns index entries of all the notes in the store, including trashed ones.
+func (s *simpleNoteClient) storeEntries() (Notes, error) {
+	notes := Notes{}
+	mark := ""
+	for {
+		l, err := s.Store.Index(mark, defaultNoteAmount, IndexOptions{})
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, l.Data...)
+		if l.Mark == "" {
+			return notes, nil
+		}
+		mark = l.Mark
+	}
+}
+
+// AliasNote gives the note alias passed by the user, or lists its aliases if none was passed.
+func (s *simpleNoteClient) aliasNote() error {
+	alias := s.Params.Flags["alias"]
+	if alias == "" {
+		fmt.Println(strings.Join(s.Aliases.For(s.Params.Key), "\n"))
+		return nil
+	}
+	if err := s.Aliases.Set(alias, s.Params.Key); err != nil {
+		return err
+	}
+	fmt.Printf("Note %s can now be referenced as %s.\n", s.Params.Key, alias)
+	return s.Aliases.Save()
+}
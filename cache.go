@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+)
+
+const (
+	defaultCacheOption = true
+	defaultCacheDir    = "~/.gonote/cache"
+)
+
+// noteCache keeps local copies of notes retrieved from remote store,
+// so only changed notes have to be fetched and reads work offline.
+// Notes are saved in the same format local backend uses.
+// All the methods are safe to call on nil cache, which is used when caching is disabled.
+type noteCache struct {
+	store *localStore
+}
+
+// newNoteCache returns cache configured for given user, or nil if notes don't need caching.
+func newNoteCache(cfg *UserConfigFile) *noteCache {
+	if !cfg.Cache || cfg.Backend == localBackend {
+		return nil
+	}
+	return &noteCache{
+		store: &localStore{Dir: ExpandPath(cfg.CacheDir)},
+	}
+}
+
+// Get returns cached copy of the note with given key.
+func (c *noteCache) Get(key string) (*Note, bool) {
+	if c == nil {
+		return nil, false
+	}
+	n, err := c.store.read(key)
+	if err != nil {
+		return nil, false
+	}
+	return n, true
+}
+
+// Fresh returns cached copy of the note only if it matches given index entry.
+func (c *noteCache) Fresh(entry *Note) (*Note, bool) {
+	n, ok := c.Get(entry.Key)
+	if !ok || n.ModifyDate != entry.ModifyDate {
+		return nil, false
+	}
+	return n, true
+}
+
+// Put saves the note in cache, keeping its modification date.
+func (c *noteCache) Put(n *Note) error {
+	if c == nil || n.Key == "" {
+		return nil
+	}
+	return c.store.write(n)
+}
+
+// Remove deletes cached copy of the note.
+func (c *noteCache) Remove(key string) error {
+	if c == nil {
+		return nil
+	}
+	if err := c.store.Purge(key); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Keys returns keys of all the cached notes.
+func (c *noteCache) Keys() ([]string, error) {
+	if c == nil {
+		return []string{}, nil
+	}
+	return c.store.keys()
+}
+
+// Cold reports whether the cache can't serve notes, because it's disabled or empty.
+func (c *noteCache) Cold() bool {
+	if c == nil {
+		return true
+	}
+	keys, err := c.store.keys()
+	return err != nil || len(keys) == 0
+}
+
+// Prune removes cached notes which are no longer present in the index.
+func (c *noteCache) Prune(index Notes) error {
+	if c == nil {
+		return nil
+	}
+	keys, err := c.store.keys()
+	if err != nil {
+		return err
+	}
+	present := make(map[string]bool, len(index))
+	for _, n := range index {
+		present[n.Key] = true
+	}
+	for _, k := range keys {
+		if !present[k] {
+			if err = c.Remove(k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
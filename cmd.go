@@ -5,28 +5,107 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"github.com/fatih/color"
 	"io"
+	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 )
 
 const (
 	tagPrefix           = "@" // Prefix for tags passed by user
 	SimpleNoteKeyLength = 32  // Length of note keys in SimpleNote
 	maxStdinLen         = 1024 * 1024
+	flagTerminator      = "--" // Arguments following it are never treated as flags or commands
 )
 
+// flagDef describes command line flag, type of the default value sets type of the flag.
+type flagDef struct {
+	Name    string
+	Default interface{}
+	Usage   string
+}
+
+var (
+	flagCount       = &flagDef{"n", -1, "Number of notes to show."}
+	flagDeleted     = &flagDef{"deleted", false, "Show notes moved to trash as well."}
+	flagPermanently = &flagDef{"permanently", false, "Delete the note permanently instead of moving it to trash."}
+	flagVersion     = &flagDef{"version", -1, "Version of the note to show, latest if not set."}
+	flagOutput      = &flagDef{"output", "", fmt.Sprintf("Output format, one of: %s.", strings.Join(OutputFormats, ", "))}
+	flagFormat      = &flagDef{"format", "", "Go template used to show notes."}
+	flagSince       = &flagDef{"since", "", "Show only notes modified since given date, e.g. 2022-10-01, or within given time: 7d for days, 36h for hours, 30m for minutes."}
+	flagProfile     = &flagDef{"profile", "", fmt.Sprintf("Configuration profile to use, overrides %s environment variable.", profileEnv)}
+
+	// Flags accepted by every command.
+	globalFlags = []*flagDef{flagProfile}
+	allFlags    = []*flagDef{flagCount, flagDeleted, flagPermanently, flagVersion, flagOutput, flagFormat, flagSince, flagProfile}
+)
+
+// command describes action available to the user.
+type command struct {
+	Name     string
+	Args     string                                          // Arguments shown in usage, e.g. KEY VERSION
+	Summary  string                                          // Single sentence shown in command list
+	NeedsKey bool                                            // Whether command works on single note, chosen by user if key is not passed
+	Flags    []*flagDef                                      // Flags accepted besides global ones
+	Parse    func(c *commandLineParser, args []string) error // Validates and stores arguments left after key and tags
+}
+
 var (
-	// Actions available for the user. Keys represent name of actions, values, whether action requires note key parameter.
-	CustomActions = &map[string]bool{
-		"version": false,
-		"list":    false,
-		"delete":  true,
-		"edit":    true,
-		"get":     true,
+	// Command used when user did not pass any, it creates new note.
+	createCommand = &command{
+		Args:    "[@TAG...] [TEXT...]",
+		Summary: "Create note from TEXT, standard input, or in editor if neither was given.",
+		Flags:   []*flagDef{flagOutput, flagFormat},
+		Parse:   parseContent,
+	}
+
+	// Commands available for the user, in order shown in the help.
+	commands = []*command{
+		{Name: "list", Args: "[@TAG...]", Summary: "List notes, most recently modified first.", Flags: []*flagDef{flagCount, flagDeleted, flagSince, flagOutput, flagFormat}, Parse: noArgs},
+		{Name: "get", Args: "[KEY]", Summary: "Show the note.", NeedsKey: true, Flags: []*flagDef{flagOutput, flagFormat}, Parse: noArgs},
+		{Name: "edit", Args: "[KEY]", Summary: "Edit the note in editor.", NeedsKey: true, Parse: noArgs},
+		{Name: "delete", Args: "[KEY]", Summary: "Move the note to trash.", NeedsKey: true, Flags: []*flagDef{flagPermanently}, Parse: noArgs},
+		{Name: "search", Args: "[@TAG...] QUERY", Summary: "Search notes, query may use AND, OR, NOT, \"phrases\", /regexps/ and date filters.", Flags: []*flagDef{flagCount, flagDeleted}, Parse: parseQuery},
+		{Name: "tui", Summary: "Browse notes in interactive terminal interface.", Parse: noArgs},
+		{Name: "alias", Args: "[KEY] [ALIAS]", Summary: "Give the note alias, or list its aliases if none was passed.", NeedsKey: true, Parse: parseAlias},
+		{Name: "history", Args: "[KEY]", Summary: "List all the versions of the note.", NeedsKey: true, Parse: noArgs},
+		{Name: "show", Args: "[KEY]", Summary: "Show the note in given version.", NeedsKey: true, Flags: []*flagDef{flagVersion, flagOutput, flagFormat}, Parse: noArgs},
+		{Name: "restore", Args: "[KEY] VERSION", Summary: "Restore the note to given version.", NeedsKey: true, Parse: parseVersion},
+		{Name: "sync", Summary: "Send changes queued while offline.", Parse: noArgs},
+		{Name: "profile", Args: "[list | add NAME | remove NAME | default NAME]", Summary: "Manage configuration profiles.", Parse: parseProfile},
+		{Name: "logout", Summary: "Forget saved access token.", Parse: noArgs},
+		{Name: "version", Summary: "Show GoNote version, also shown by gonote --version.", Parse: noArgs},
+		{Name: "completion", Args: "SHELL", Summary: "Print completion script for bash, zsh or fish.", Parse: parseShell},
+		{Name: "help", Args: "[COMMAND]", Summary: "Show help for the command.", Parse: parseHelp},
 	}
 )
 
+// lookupCommand returns command with given name.
+func lookupCommand(name string) (*command, bool) {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd, true
+		}
+	}
+	return nil, false
+}
+
+// suggestCommand returns name of the command user most likely meant, or empty string if none is close enough.
+func suggestCommand(name string) string {
+	best, bestDistance := "", 0
+	for _, cmd := range commands {
+		d := EditDistance(strings.ToLower(name), cmd.Name)
+		// Allow one typo per three characters, so short words are not mistaken for commands.
+		if d <= len(cmd.Name)/3 && name != cmd.Name && (best == "" || d < bestDistance) {
+			best, bestDistance = cmd.Name, d
+		}
+	}
+	return best
+}
+
 // cmmandLineParser contains both user parameters and configuration file.
 type commandLineParser struct {
 	Params *CommandLineParams
@@ -39,6 +118,7 @@ type CommandLineParams struct {
 	Tags    []string          // List of tags to be used with requests
 	Action  string            // Action represents custom action performed by user
 	Key     string            // For some actions Note key is required
+	Query   string            // Query used with search action
 	Flags   map[string]string // Flags are additional params passed with some commands
 	Piped   bool
 }
@@ -47,8 +127,8 @@ type CommandLineParams struct {
 type CommandLineParser interface {
 	Grab() (*CommandLineParams, error)
 	getTags([]string) []string
-	getAction([]string) ([]string, error)
-	getFlags([]string) []string
+	getCommand([]string) (*command, []string)
+	getFlags(*command, []string) ([]string, []string, error)
 }
 
 // NewCommandLineParser returns new command parser interface.
@@ -68,20 +148,90 @@ func (c *commandLineParser) Grab() (params *CommandLineParams, err error) {
 	return c.Params, err
 }
 
-//Get flags retrieves all flags passed by the user.
-func (c *commandLineParser) getFlags(args []string) []string {
-	var flagListItemCount int
-	var flagListShowDeleted, flagDeletePermanently bool
-	cmdFlagSet := flag.NewFlagSet("", flag.ExitOnError)
-	cmdFlagSet.IntVar(&flagListItemCount, "n", -1, "Number of items to show with list command.")
-	cmdFlagSet.BoolVar(&flagListShowDeleted, "deleted", false, "Whether to show deleted items with list command.")
-	cmdFlagSet.BoolVar(&flagDeletePermanently, "permanently", false, "If true will permanently delete the note instead of moving it to trash.")
-	cmdFlagSet.Parse(args)
-	c.Params.Flags["n"] = ConvertToString(flagListItemCount)
-	c.Params.Flags["deleted"] = ConvertToString(flagListShowDeleted)
-	c.Params.Flags["permanently"] = ConvertToString(flagDeletePermanently)
-	// Return all remaining arguments
-	return cmdFlagSet.Args()
+// GetCommand finds command passed by the user, which is first argument not being a flag.
+// Returns remaining arguments, with flags preceding the command kept in place.
+func (c *commandLineParser) getCommand(args []string) (*command, []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == flagTerminator {
+			break
+		}
+		if strings.HasPrefix(arg, "-") && len(arg) > 1 {
+			name := strings.TrimLeft(arg, "-")
+			if def := findFlag(name); def != nil && !strings.Contains(name, "=") {
+				if _, isBool := def.Default.(bool); !isBool {
+					i++ // Skip flag value
+				}
+			}
+			continue
+		}
+		if cmd, ok := lookupCommand(arg); ok {
+			return cmd, append(append([]string{}, args[:i]...), args[i+1:]...)
+		}
+		break
+	}
+	if len(args) > 0 && (args[0] == "--version" || args[0] == "-version") {
+		// Conventional way of asking for program version, outside of show the flag means note version.
+		cmd, _ := lookupCommand("version")
+		return cmd, args[1:]
+	}
+	return createCommand, args
+}
+
+// findFlag returns definition of the flag with given name.
+func findFlag(name string) *flagDef {
+	for _, def := range allFlags {
+		if def.Name == name {
+			return def
+		}
+	}
+	return nil
+}
+
+// GetFlags parses flags accepted by the command, which may be placed anywhere among
+// other arguments. Returns remaining arguments and ones passed after flag terminator.
+func (c *commandLineParser) getFlags(cmd *command, args []string) (positional []string, literal []string, err error) {
+	for _, def := range allFlags {
+		c.Params.Flags[def.Name] = ConvertToString(def.Default)
+	}
+	cmdFlagSet := newFlagSet(cmd)
+	cmdFlagSet.SetOutput(ioutil.Discard)
+	positional = []string{}
+	for {
+		if err = cmdFlagSet.Parse(args); err != nil {
+			return nil, nil, err
+		}
+		rest := cmdFlagSet.Args()
+		if len(rest) < len(args) && args[len(args)-len(rest)-1] == flagTerminator {
+			literal = rest
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	cmdFlagSet.VisitAll(func(f *flag.Flag) {
+		c.Params.Flags[f.Name] = f.Value.String()
+	})
+	return positional, literal, nil
+}
+
+// newFlagSet returns set of flags accepted by the command.
+func newFlagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	for _, def := range append(append([]*flagDef{}, cmd.Flags...), globalFlags...) {
+		switch val := def.Default.(type) {
+		case bool:
+			fs.Bool(def.Name, val, def.Usage)
+		case int:
+			fs.Int(def.Name, val, def.Usage)
+		default:
+			fs.String(def.Name, ConvertToString(val), def.Usage)
+		}
+	}
+	return fs
 }
 
 // Check if arguments have any tags defined if so pop it from the list and save.
@@ -103,30 +253,6 @@ func (c *commandLineParser) getTags(args []string) []string {
 	return args
 }
 
-// GetAction retrieves custom user action from command line.
-func (c *commandLineParser) getAction(args []string) ([]string, error) {
-	if len(args) == 0 {
-		return args, nil
-	}
-	for action, requiresKey := range *CustomActions {
-		if action == args[0] {
-			c.Params.Action = action
-			if requiresKey {
-				if len(args) < 2 {
-					return nil, errors.New("Missing note key parameter.")
-				}
-				if len(args[1]) != SimpleNoteKeyLength {
-					return nil, errors.New("Invalid identifier passed")
-				}
-				c.Params.Key = strings.TrimSpace(args[1])
-				return args[2:], nil
-			}
-			return args[1:], nil
-		}
-	}
-	return args, nil
-}
-
 // GetStdin retrieves STDIN string if available
 func (c *commandLineParser) getStdin() (in string, err error) {
 	if c.Params.Piped {
@@ -156,35 +282,199 @@ func (c *commandLineParser) getStdin() (in string, err error) {
 	return "", nil
 }
 
-// Parse retrieves content of a note to be saved.
+// Parse retrieves command passed by the user together with its arguments.
 func (c *commandLineParser) parse(args []string) (err error) {
 	stat, _ := os.Stdin.Stat()
 	c.Params.Piped = ((stat.Mode() & os.ModeCharDevice) == 0)
-	actionless, err := c.getAction(args)
-	if err != nil {
-		return err
+	cmd, args := c.getCommand(args)
+	c.Params.Action = cmd.Name
+	positional, literal, err := c.getFlags(cmd, args)
+	if err == flag.ErrHelp {
+		c.Params.Action = "help"
+		c.Params.Flags["command"] = cmd.Name
+		return nil
+	} else if err != nil {
+		if cmd == createCommand && len(args) > 0 {
+			// Flags note creation does not accept tell the first word was meant to be a command.
+			if suggestion := suggestCommand(args[0]); suggestion != "" {
+				return unknownCommandError(args[0], suggestion, args)
+			}
+		}
+		return errors.New(fmt.Sprintf("%s, run `%s` for usage.", err, helpCommandLine(cmd)))
+	}
+	if cmd.NeedsKey && len(positional) > 0 && !strings.HasPrefix(positional[0], tagPrefix) {
+		// Key may also be an alias or key prefix, it's resolved by the client.
+		c.Params.Key = strings.TrimSpace(positional[0])
+		positional = positional[1:]
+	}
+	positional = c.getTags(positional)
+	if cmd == createCommand && len(positional) == 1 && len(literal) == 0 {
+		// Single words such as "snow" make fine notes, unless they differ from command only by letter case.
+		if named, ok := lookupCommand(strings.ToLower(positional[0])); ok {
+			return unknownCommandError(positional[0], named.Name, positional)
+		}
+	}
+	if output := c.Params.Flags["output"]; output != "" {
+		if !CheckIn(output, OutputFormats) {
+			return errors.New(fmt.Sprintf("Unknown output format: %s, available formats are: %s", output, strings.Join(OutputFormats, ", ")))
+		}
+		if c.Params.Flags["format"] != "" {
+			return errors.New("Only one of --output and --format can be used.")
+		}
+		if output == outputPlain {
+			color.NoColor = true
+		}
+	}
+	if since := c.Params.Flags["since"]; since != "" {
+		if c.Params.Flags["since"], err = ParseSince(since); err != nil {
+			return err
+		}
+	}
+	return cmd.Parse(c, append(positional, literal...))
+}
+
+// unknownCommandError describes arguments which look like mistyped command, telling
+// how to create note from them instead.
+func unknownCommandError(name, suggestion string, args []string) error {
+	return errors.New(fmt.Sprintf("Unknown command: %s, did you mean %s? Use `gonote -- %s` to create note with this text.", name, suggestion, strings.Join(args, " ")))
+}
+
+// noArgs rejects any arguments besides note key and tags.
+func noArgs(c *commandLineParser, args []string) error {
+	if len(args) > 0 {
+		return errors.New(fmt.Sprintf("Unexpected argument: %s, run `gonote help %s` for usage.", args[0], c.Params.Action))
 	}
-	tagless := c.getTags(actionless)
-	flagless := c.getFlags(tagless)
-	// If action is defined we don't need any content passed
+	return nil
+}
+
+// parseContent reads content of the note to be created.
+func parseContent(c *commandLineParser, args []string) error {
 	if c.Params.Piped {
 		content, err := c.getStdin()
 		if err != nil {
 			return err
 		}
 		c.Params.Content = content
-	} else if c.Params.Action == "" {
-		if len(flagless) > 0 {
-			c.Params.Content = strings.Join(flagless, " ")
-		} else {
-			content, err := WriteToFile("")
-			if err != nil {
-				return err
+	} else if len(args) > 0 {
+		c.Params.Content = strings.Join(args, " ")
+	} else {
+		content, err := WriteToFile("")
+		if err != nil {
+			return err
+		}
+		c.Params.Content = strings.TrimSpace(content)
+	}
+	return nil
+}
+
+// parseQuery reads search query, made of all the remaining arguments.
+func parseQuery(c *commandLineParser, args []string) error {
+	if len(args) == 0 {
+		return errors.New("Missing search query.")
+	}
+	c.Params.Query = strings.Join(args, " ")
+	return nil
+}
+
+// parseAlias reads alias to give the note, if any was passed.
+func parseAlias(c *commandLineParser, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	c.Params.Flags["alias"] = args[0]
+	return noArgs(c, args[1:])
+}
+
+// parseVersion reads version to restore, passed right after the key.
+// Single argument is the version, note is then chosen by the user.
+func parseVersion(c *commandLineParser, args []string) error {
+	if len(args) == 0 && c.Params.Key != "" {
+		args, c.Params.Key = []string{c.Params.Key}, ""
+	}
+	if len(args) == 0 {
+		return errors.New("Missing note version parameter.")
+	}
+	if _, err := strconv.Atoi(args[0]); err != nil {
+		return errors.New("Invalid note version passed")
+	}
+	c.Params.Flags["version"] = args[0]
+	return noArgs(c, args[1:])
+}
+
+// parseProfile reads profile subcommand followed by profile name, e.g. profile add work.
+func parseProfile(c *commandLineParser, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	c.Params.Flags["command"] = args[0]
+	if len(args) == 1 {
+		return nil
+	}
+	c.Params.Flags["name"] = args[1]
+	return noArgs(c, args[2:])
+}
+
+// parseShell reads name of the shell to print completion script for.
+func parseShell(c *commandLineParser, args []string) error {
+	if len(args) == 0 {
+		return errors.New(fmt.Sprintf("Missing shell name, available shells are: %s", strings.Join(completionShells, ", ")))
+	}
+	c.Params.Flags["shell"] = args[0]
+	return noArgs(c, args[1:])
+}
+
+// parseHelp reads name of the command to show help for, if any was passed.
+func parseHelp(c *commandLineParser, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	c.Params.Flags["command"] = args[0]
+	return noArgs(c, args[1:])
+}
+
+// helpCommandLine returns command showing help for given command.
+func helpCommandLine(cmd *command) string {
+	if cmd.Name == "" {
+		return "gonote help"
+	}
+	return "gonote help " + cmd.Name
+}
+
+// showHelp prints usage of the command with given name, or list of commands if name is empty.
+func showHelp(w io.Writer, name string) error {
+	cmd := createCommand
+	if name != "" {
+		var ok bool
+		if cmd, ok = lookupCommand(name); !ok {
+			if suggestion := suggestCommand(name); suggestion != "" {
+				return errors.New(fmt.Sprintf("Unknown command: %s, did you mean %s?", name, suggestion))
 			}
-			c.Params.Content = strings.TrimSpace(content)
+			return errors.New(fmt.Sprintf("Unknown command: %s, run `gonote help` to list commands.", name))
 		}
-	} else {
-		return
 	}
-	return
+	fmt.Fprintf(w, "Usage: %s\n", strings.Join(strings.Fields("gonote "+cmd.Name+" "+cmd.Args), " "))
+	if cmd == createCommand {
+		fmt.Fprintln(w, "       gonote COMMAND [ARGUMENTS]")
+	}
+	fmt.Fprintf(w, "\n%s\n", cmd.Summary)
+	if cmd.NeedsKey {
+		fmt.Fprintln(w, "KEY may be note key, its unique prefix or alias. Note is chosen from the list if it's not passed.")
+	}
+	if cmd == createCommand {
+		fmt.Fprintln(w, "\nCommands:")
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, c := range commands {
+			fmt.Fprintf(tw, "  %s\t%s\n", c.Name, c.Summary)
+		}
+		tw.Flush()
+	}
+	fmt.Fprintln(w, "\nFlags:")
+	fs := newFlagSet(cmd)
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+	if cmd == createCommand {
+		fmt.Fprintln(w, "\nFlags may be placed anywhere among the arguments, arguments following -- are never treated as flags.")
+		fmt.Fprintln(w, "Run `gonote help COMMAND` for details about the command.")
+	}
+	return nil
 }
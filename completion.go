@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	completeCommand = "__complete" // Hidden command called by completion scripts
+	completionHint  = "\t"         // Separates completion candidate from its description
+)
+
+var (
+	// Completion scripts call gonote back with words typed so far, last of them being completed.
+	// Candidates are printed one per line, optionally followed by tab and description.
+	completionScripts = map[string]string{
+		"bash": `_gonote() {
+	# COMP_WORDS is split at characters like @ and :, so words are taken from the line itself.
+	local line=${COMP_LINE:0:COMP_POINT}
+	local -a words
+	read -ra words <<< "$line"
+	[[ $line == *[[:space:]] ]] && words+=("")
+	# Bash replaces only part of the word following such characters.
+	local cur=${words[${#words[@]}-1]}
+	local prefix=${cur%"${cur##*[@:=]}"}
+	local IFS=$'\n'
+	COMPREPLY=($(gonote __complete "${words[@]:1}" 2>/dev/null | cut -f1))
+	COMPREPLY=("${COMPREPLY[@]#"$prefix"}")
+}
+complete -F _gonote gonote
+`,
+		"zsh": `#compdef gonote
+_gonote() {
+	local -a candidates
+	local line
+	for line in "${(@f)$(gonote __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}"; do
+		[[ -z $line ]] && continue
+		if [[ $line == *$'\t'* ]]; then
+			candidates+=("${${line%%$'\t'*}//:/\\:}:${line#*$'\t'}")
+		else
+			candidates+=("${line//:/\\:}")
+		fi
+	done
+	_describe 'gonote' candidates
+}
+compdef _gonote gonote
+`,
+		"fish": `function __gonote_complete
+	set -l tokens (commandline -opc) (commandline -ct)
+	gonote __complete $tokens[2..-1] 2>/dev/null
+end
+complete -c gonote -f -a '(__gonote_complete)'
+`,
+	}
+	completionShells = []string{"bash", "zsh", "fish"}
+)
+
+// printCompletionScript prints completion script for given shell.
+func printCompletionScript(w io.Writer, shell string) error {
+	script, ok := completionScripts[shell]
+	if !ok {
+		return errors.New(fmt.Sprintf("Unsupported shell: %s, available shells are: %s", shell, strings.Join(completionShells, ", ")))
+	}
+	_, err := io.WriteString(w, script)
+	return err
+}
+
+// completer suggests arguments using only search index and aliases kept on disk,
+// so completion is instant and works offline.
+type completer struct {
+	Config  MainConfig
+	Index   *searchIndex
+	Aliases *aliasTable
+}
+
+// newCompleter returns completer reading data of the profile in use.
+func newCompleter(config MainConfig) *completer {
+	return &completer{
+		Config:  config,
+		Index:   newSearchIndex(ExpandPath(config.GetUserConfig().dataPath(defaultIndexPath))),
+		Aliases: newAliasTable(ExpandPath(config.GetUserConfig().dataPath(defaultAliasesPath))),
+	}
+}
+
+// complete prints candidates for the last of words passed to completion command.
+func complete(w io.Writer, config MainConfig, words []string) {
+	// Missing configuration file is not created, completion must not prompt for anything.
+	if config.read() == nil && config.selectProfile(profileArg(words)) != nil {
+		config.selectProfile(defaultProfile)
+	}
+	newCompleter(config).Complete(w, words)
+}
+
+// Complete prints candidates for the last of given words. Nothing is printed on errors,
+// as they would end up in the middle of user command line.
+func (c *completer) Complete(w io.Writer, words []string) {
+	cur := ""
+	if len(words) > 0 {
+		cur, words = words[len(words)-1], words[:len(words)-1]
+	}
+	for _, candidate := range c.candidates(words, cur) {
+		if strings.HasPrefix(candidate, cur) {
+			fmt.Fprintln(w, candidate)
+		}
+	}
+}
+
+// profileArg returns value of profile flag passed among the words.
+func profileArg(words []string) string {
+	for i, word := range words {
+		if word == "--profile" || word == "-profile" {
+			if i+1 < len(words) {
+				return words[i+1]
+			}
+		} else if strings.HasPrefix(word, "--profile=") || strings.HasPrefix(word, "-profile=") {
+			return word[strings.Index(word, "=")+1:]
+		}
+	}
+	return ""
+}
+
+// candidates returns arguments which may follow given words.
+func (c *completer) candidates(words []string, cur string) []string {
+	if CheckIn(flagTerminator, words) {
+		// Rest of the command line is note content.
+		return nil
+	}
+	cmd, rest := (&commandLineParser{}).getCommand(words)
+	if len(rest) > 0 {
+		if def := findFlag(strings.TrimLeft(rest[len(rest)-1], "-")); def != nil && strings.HasPrefix(rest[len(rest)-1], "-") {
+			if _, isBool := def.Default.(bool); !isBool {
+				return c.flagValues(def)
+			}
+		}
+	}
+	if strings.HasPrefix(cur, "-") {
+		return flagCandidates(cmd)
+	}
+	if strings.HasPrefix(cur, tagPrefix) {
+		return c.tags()
+	}
+	args := positionalArgs(rest)
+	switch {
+	case cmd == createCommand && len(args) == 0:
+		return commandCandidates()
+	case cmd.NeedsKey && len(args) == 0:
+		return c.keys()
+	case cmd.Name == "help" && len(args) == 0:
+		return commandCandidates()
+	case cmd.Name == "completion" && len(args) == 0:
+		return completionShells
+	case cmd.Name == "profile" && len(args) == 0:
+		return []string{"list", "add", "remove", "default"}
+	case cmd.Name == "profile" && len(args) == 1 && (args[0] == "remove" || args[0] == "default"):
+		return c.Config.profileNames()
+	}
+	return nil
+}
+
+// positionalArgs returns words which are neither flags nor their values.
+func positionalArgs(words []string) []string {
+	args := []string{}
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		if strings.HasPrefix(word, "-") && len(word) > 1 {
+			if def := findFlag(strings.TrimLeft(word, "-")); def != nil {
+				if _, isBool := def.Default.(bool); !isBool {
+					i++
+				}
+			}
+			continue
+		}
+		args = append(args, word)
+	}
+	return args
+}
+
+func commandCandidates() []string {
+	candidates := []string{}
+	for _, cmd := range commands {
+		candidates = append(candidates, cmd.Name+completionHint+cmd.Summary)
+	}
+	return candidates
+}
+
+func flagCandidates(cmd *command) []string {
+	candidates := []string{}
+	for _, def := range append(append([]*flagDef{}, cmd.Flags...), globalFlags...) {
+		prefix := "--"
+		if len(def.Name) == 1 {
+			prefix = "-"
+		}
+		candidates = append(candidates, prefix+def.Name+completionHint+def.Usage)
+	}
+	return candidates
+}
+
+// flagValues returns values accepted by the flag, if there is fixed set of them.
+func (c *completer) flagValues(def *flagDef) []string {
+	switch def {
+	case flagOutput:
+		return OutputFormats
+	case flagProfile:
+		return c.Config.profileNames()
+	}
+	return nil
+}
+
+// keys returns keys of indexed notes which are not in trash, most recently modified first,
+// with their titles as description. Aliases set by the user are suggested as well.
+func (c *completer) keys() []string {
+	candidates := []string{}
+	titles := make(map[string]string)
+	notes := c.Index.All()
+	sort.Stable(sort.Reverse(notes))
+	for _, n := range notes {
+		if n.Deleted == 1 {
+			continue
+		}
+		if d, ok := c.Index.Doc(n.Key); ok {
+			titles[n.Key] = d.Title
+		}
+		candidates = append(candidates, withHint(n.Key, titles[n.Key]))
+	}
+	for _, alias := range c.Aliases.Named() {
+		key, _ := c.Aliases.Lookup(alias)
+		if title, ok := titles[key]; ok {
+			candidates = append(candidates, withHint(alias, title))
+		}
+	}
+	return candidates
+}
+
+// tags returns all the tags of indexed notes, with tag prefix.
+func (c *completer) tags() []string {
+	seen := make(map[string]bool)
+	candidates := []string{}
+	for _, n := range c.Index.All() {
+		for _, t := range n.Tags {
+			if !seen[t] {
+				seen[t] = true
+				candidates = append(candidates, tagPrefix+t)
+			}
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// withHint appends description to the candidate, if there is any.
+func withHint(candidate, hint string) string {
+	if hint == "" {
+		return candidate
+	}
+	return candidate + completionHint + hint
+}
@@ -15,36 +15,90 @@ import (
 const (
 	defaultConfigFilename = ".gonote.json"
 	defaultMarkdownOption = true
+	defaultBackend        = simpleNoteBackend
+	defaultNotesDir       = "~/.gonote/notes"
+	defaultProfile        = "default" // Name of the profile kept at the top level of configuration file
+	profilesDir           = "~/.gonote/profiles"
+	profileEnv            = "GONOTE_PROFILE" // Environment variable holding name of the profile to use
 )
 
 // Main configuration interface used to interact with configuration file.
 type MainConfig interface {
 	Load() error
+	LoadExisting() error
 	GetUserConfig() *UserConfigFile
+	UseProfile(name string) error
+	ListProfiles()
+	AddProfile(name string) error
+	RemoveProfile(name string) error
+	SetDefaultProfile(name string) error
 	read() error
 	create() error
+	selectProfile(name string) error
+	profileNames() []string
 }
 
 type mainConfig struct {
 	Path    string
-	UserCfg *UserConfigFile
+	File    *UserConfigFile // Whole configuration file, holding default profile and named ones
+	UserCfg *UserConfigFile // Profile in use
+	Input   *bufio.Reader   // Answers to prompts, shared so input buffered by one prompt is not lost
 }
 
 // Structure representing user configuration file.
 type UserConfigFile struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
-	Markdown bool   `json:"markdown"`
+	Email       string `json:"email"`
+	Password    string `json:"password,omitempty"`    // Plain text password, only kept by configuration files from older versions
+	Credentials string `json:"credentials,omitempty"` // Where the password is kept, e.g. file:~/.gonote/credentials.json
+	Markdown    bool   `json:"markdown"`
+	Backend     string `json:"backend"`   // Note store to use, either "simplenote" or "local"
+	NotesDir    string `json:"notes_dir"` // Directory holding notes when using local backend
+	Cache       bool   `json:"cache"`     // Whether to keep local copies of SimpleNote notes
+	CacheDir    string `json:"cache_dir"` // Directory holding cached notes
+
+	ListFormat string `json:"list_format,omitempty"` // Template used for each note shown with list command
+	GetFormat  string `json:"get_format,omitempty"`  // Template used for note shown with get command
+	Picker     string `json:"picker,omitempty"`      // External command used to choose note when key is not passed, e.g. fzf
+
+	FetchWorkers   int `json:"fetch_workers,omitempty"`   // Number of notes fetched at once, defaults to 8
+	RequestTimeout int `json:"request_timeout,omitempty"` // Time limit of single SimpleNote request in seconds, defaults to 30
+
+	DefaultProfile string                     `json:"default_profile,omitempty"` // Profile used when none was chosen
+	Profiles       map[string]*UserConfigFile `json:"profiles,omitempty"`        // Named profiles, e.g. for work and personal accounts
+	Profile        string                     `json:"-"`                         // Name of this profile, empty for the default one
+}
+
+// newUserConfig returns profile with default settings.
+func newUserConfig(profile string) *UserConfigFile {
+	cfg := &UserConfigFile{
+		Markdown: defaultMarkdownOption,
+		Backend:  defaultBackend,
+		Profile:  profile,
+	}
+	cfg.NotesDir = cfg.dataPath(defaultNotesDir)
+	cfg.Cache = defaultCacheOption
+	cfg.CacheDir = cfg.dataPath(defaultCacheDir)
+	return cfg
+}
+
+// dataPath returns location of GoNote data file for this profile. Named profiles
+// keep their files in separate directories, so accounts don't mix.
+func (cfg *UserConfigFile) dataPath(p string) string {
+	if cfg.Profile == "" {
+		return p
+	}
+	return path.Join(profilesDir, cfg.Profile, path.Base(p))
 }
 
 // Return new configation instance.
 func NewConfigFile() MainConfig {
 	usr, _ := user.Current()
+	cfg := newUserConfig("")
 	return &mainConfig{
-		Path: path.Join(usr.HomeDir, defaultConfigFilename),
-		UserCfg: &UserConfigFile{
-			Markdown: defaultMarkdownOption,
-		},
+		Path:    path.Join(usr.HomeDir, defaultConfigFilename),
+		File:    cfg,
+		UserCfg: cfg,
+		Input:   bufio.NewReader(os.Stdin),
 	}
 }
 
@@ -74,6 +128,46 @@ func (c *mainConfig) Load() (err error) {
 	return
 }
 
+// LoadExisting reads configuration file if there is one, keeping default settings otherwise.
+func (c *mainConfig) LoadExisting() error {
+	if _, err := os.Stat(c.Path); os.IsNotExist(err) {
+		return nil
+	}
+	return c.read()
+}
+
+// input returns reader of answers to prompts.
+func (c *mainConfig) input() *bufio.Reader {
+	if c.Input == nil {
+		c.Input = bufio.NewReader(os.Stdin)
+	}
+	return c.Input
+}
+
+// Move plain text password kept by older configuration files to encrypted credentials file.
+func (c *mainConfig) migrate() (err error) {
+	if c.UserCfg.Password == "" || c.UserCfg.Credentials != "" {
+		return
+	}
+	if stat, _ := os.Stdin.Stat(); stat == nil || (stat.Mode()&os.ModeCharDevice) == 0 {
+		fmt.Fprintf(os.Stderr, "Warning: SimpleNote password is kept in plain text in %s, run gonote from terminal to encrypt it.\n", c.Path)
+		return
+	}
+	fmt.Fprintln(os.Stderr, "SimpleNote password is kept in plain text, moving it to encrypted credentials file.")
+	passphrase, err := readNewPassphrase(c.input())
+	if err != nil {
+		return
+	}
+	credsPath := c.UserCfg.dataPath(defaultCredentialsFile)
+	creds := &fileCredentials{Path: ExpandPath(credsPath)}
+	if err = creds.Save(c.UserCfg.Email, c.UserCfg.Password, passphrase); err != nil {
+		return
+	}
+	c.UserCfg.Credentials = credentialsFile + ":" + credsPath
+	c.UserCfg.Password = ""
+	return c.save()
+}
+
 // Read configuration file from disk.
 func (c *mainConfig) read() (err error) {
 	if c.Path == "" {
@@ -83,8 +177,21 @@ func (c *mainConfig) read() (err error) {
 	if err != nil {
 		return
 	}
+	defer file.Close()
 	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&c.UserCfg)
+	if err = decoder.Decode(c.File); err != nil {
+		return
+	}
+	for name, p := range c.File.Profiles {
+		p.Profile = name
+		if p.NotesDir == "" {
+			p.NotesDir = p.dataPath(defaultNotesDir)
+		}
+		if p.CacheDir == "" {
+			p.CacheDir = p.dataPath(defaultCacheDir)
+		}
+	}
+	c.UserCfg = c.File
 	return
 }
 
@@ -92,18 +199,80 @@ func (c *mainConfig) read() (err error) {
 // in user directory.
 func (c *mainConfig) create() (err error) {
 	fmt.Println("Creating new GoNote configuration file")
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Println("Enter SimpleNote email:")
-	// TODO: Refactor it
-	c.UserCfg.Email, err = reader.ReadString('\n')
-	c.UserCfg.Email = strings.TrimSpace(c.UserCfg.Email)
-	fmt.Println("Enter SimpleNote password:")
-	c.UserCfg.Password, err = reader.ReadString('\n')
-	c.UserCfg.Password = strings.TrimSpace(c.UserCfg.Password)
+	if err = c.prompt(); err != nil {
+		return
+	}
+	return c.save()
+}
+
+// Ask user for settings of the profile in use.
+func (c *mainConfig) prompt() (err error) {
+	reader := c.input()
+	fmt.Printf("Enter note backend (%s, %s) [%s]:\n", simpleNoteBackend, localBackend, defaultBackend)
+	backend, err := reader.ReadString('\n')
+	if backend = strings.TrimSpace(backend); backend != "" {
+		c.UserCfg.Backend = backend
+	}
+	if c.UserCfg.Backend == localBackend {
+		fmt.Printf("Enter notes directory [%s]:\n", c.UserCfg.NotesDir)
+		notesDir, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if notesDir = strings.TrimSpace(notesDir); notesDir != "" {
+			c.UserCfg.NotesDir = notesDir
+		}
+	} else {
+		fmt.Println("Enter SimpleNote email:")
+		// TODO: Refactor it
+		c.UserCfg.Email, err = reader.ReadString('\n')
+		c.UserCfg.Email = strings.TrimSpace(c.UserCfg.Email)
+		if err = c.createCredentials(reader); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Ask user where SimpleNote password should be kept, storing it in encrypted file by default.
+func (c *mainConfig) createCredentials(reader *bufio.Reader) (err error) {
+	fmt.Printf("Enter password source (%s, %s:VAR, %s:CMD, %s:PROGRAM) [%s]:\n",
+		credentialsFile, credentialsEnv, credentialsCommand, credentialsHelper, credentialsFile)
+	source, err := reader.ReadString('\n')
 	if err != nil {
 		return
 	}
-	f, err := json.MarshalIndent(c.UserCfg, "", "\t")
-	err = ioutil.WriteFile(c.Path, f, 0751)
+	if source = strings.TrimSpace(source); source != "" && source != credentialsFile {
+		c.UserCfg.Credentials = source
+		_, err = newCredentialProvider(c.UserCfg)
+		return
+	}
+	password, err := readSecret(reader, "Enter SimpleNote password:")
+	if err != nil {
+		return
+	}
+	passphrase, err := readNewPassphrase(reader)
+	if err != nil {
+		return
+	}
+	credsPath := c.UserCfg.dataPath(defaultCredentialsFile)
+	creds := &fileCredentials{Path: ExpandPath(credsPath)}
+	if err = creds.Save(c.UserCfg.Email, password, passphrase); err != nil {
+		return
+	}
+	c.UserCfg.Credentials = credentialsFile + ":" + credsPath
 	return
 }
+
+// Write configuration file to disk, readable only by the user.
+func (c *mainConfig) save() (err error) {
+	f, err := json.MarshalIndent(c.File, "", "\t")
+	if err != nil {
+		return
+	}
+	if err = ioutil.WriteFile(c.Path, f, 0600); err != nil {
+		return
+	}
+	// WriteFile keeps permissions of existing file.
+	return os.Chmod(c.Path, 0600)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	credentialsFile    = "file"    // Password encrypted with passphrase, e.g. file:~/.gonote/credentials.json
+	credentialsEnv     = "env"     // Password kept in environment variable, e.g. env:SIMPLENOTE_PASSWORD
+	credentialsCommand = "command" // Password printed by command, e.g. command:pass show simplenote
+	credentialsHelper  = "helper"  // Git style credential helper, e.g. helper:git-credential-osxkeychain
+
+	defaultCredentialsFile = "~/.gonote/credentials.json"
+	passphraseEnv          = "GONOTE_PASSPHRASE" // Environment variable holding passphrase of encrypted credentials file
+	credentialsHost        = "simple-note.appspot.com"
+	keyLength              = 32
+	saltLength             = 16
+
+	// Argon2id parameters used for new credentials files, as recommended in RFC 9106.
+	kdfArgon2id   = "argon2id"
+	argon2Time    = 1
+	argon2Memory  = 64 * 1024 // KiB
+	argon2Threads = 4
+)
+
+// CredentialProvider retrieves SimpleNote password, so it does not have to be kept in configuration file.
+type CredentialProvider interface {
+	Password(email string) (string, error)
+}
+
+// newCredentialProvider returns provider for credentials reference kept in user configuration,
+// which has form of "<source>:<argument>".
+func newCredentialProvider(cfg *UserConfigFile) (CredentialProvider, error) {
+	if cfg.Credentials == "" {
+		// Configuration from before credentials were introduced.
+		return plainCredentials(cfg.Password), nil
+	}
+	parts := strings.SplitN(cfg.Credentials, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, errors.New(fmt.Sprintf("Invalid credentials reference: %s", cfg.Credentials))
+	}
+	switch parts[0] {
+	case credentialsFile:
+		return &fileCredentials{Path: ExpandPath(parts[1])}, nil
+	case credentialsEnv:
+		return envCredentials(parts[1]), nil
+	case credentialsCommand:
+		return commandCredentials(parts[1]), nil
+	case credentialsHelper:
+		return helperCredentials(parts[1]), nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unknown credentials source: %s", parts[0]))
+}
+
+// plainCredentials is password stored directly in configuration file.
+type plainCredentials string
+
+func (c plainCredentials) Password(email string) (string, error) {
+	return string(c), nil
+}
+
+// envCredentials reads password from environment variable with given name.
+type envCredentials string
+
+func (c envCredentials) Password(email string) (string, error) {
+	password := os.Getenv(string(c))
+	if password == "" {
+		return "", errors.New(fmt.Sprintf("Environment variable %s holding SimpleNote password is not set.", string(c)))
+	}
+	return password, nil
+}
+
+// commandCredentials runs shell command, such as `pass show simplenote`
+// or `gpg -d password.gpg`, and uses first line of its output as password.
+type commandCredentials string
+
+func (c commandCredentials) Password(email string) (string, error) {
+	cmd := exec.Command("sh", "-c", string(c))
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Password command failed: %s", err))
+	}
+	password := strings.SplitN(string(out), "\n", 2)[0]
+	if password == "" {
+		return "", errors.New("Password command did not print any password.")
+	}
+	return password, nil
+}
+
+// helperCredentials talks to external program using git credential helper protocol,
+// e.g. git-credential-libsecret or git-credential-osxkeychain.
+type helperCredentials string
+
+func (c helperCredentials) Password(email string) (string, error) {
+	cmd := exec.Command("sh", "-c", string(c)+" get")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=https\nhost=%s\nusername=%s\n\n", credentialsHost, email))
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Credential helper failed: %s", err))
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "password=") {
+			return strings.TrimPrefix(scanner.Text(), "password="), nil
+		}
+	}
+	return "", errors.New("Credential helper did not return any password.")
+}
+
+// fileCredentials keeps password in file encrypted with AES-GCM, using key derived from user passphrase.
+type fileCredentials struct {
+	Path string
+}
+
+// encryptedCredentials represents contents of encrypted credentials file.
+type encryptedCredentials struct {
+	KDF     string `json:"kdf"` // Key derivation function
+	Rounds  int    `json:"rounds"`
+	Memory  uint32 `json:"memory"` // Memory used by Argon2, in KiB
+	Threads uint8  `json:"threads"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+func (c *fileCredentials) Password(email string) (string, error) {
+	data, err := ioutil.ReadFile(c.Path)
+	if err != nil {
+		return "", err
+	}
+	enc := &encryptedCredentials{}
+	if err = json.Unmarshal(data, enc); err != nil {
+		return "", err
+	}
+	passphrase, err := readPassphrase("Enter GoNote passphrase:")
+	if err != nil {
+		return "", err
+	}
+	gcm, err := enc.cipher(passphrase)
+	if err != nil {
+		return "", err
+	}
+	password, err := gcm.Open(nil, enc.Nonce, enc.Data, []byte(email))
+	if err != nil {
+		return "", errors.New("Could not decrypt credentials, check if passphrase is valid.")
+	}
+	return string(password), nil
+}
+
+// Save encrypts password with passphrase and writes it to the file.
+func (c *fileCredentials) Save(email, password, passphrase string) error {
+	enc := &encryptedCredentials{
+		KDF:     kdfArgon2id,
+		Rounds:  argon2Time,
+		Memory:  argon2Memory,
+		Threads: argon2Threads,
+		Salt:    make([]byte, saltLength),
+	}
+	if _, err := rand.Read(enc.Salt); err != nil {
+		return err
+	}
+	gcm, err := enc.cipher(passphrase)
+	if err != nil {
+		return err
+	}
+	enc.Nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(enc.Nonce); err != nil {
+		return err
+	}
+	enc.Data = gcm.Seal(nil, enc.Nonce, []byte(password), []byte(email))
+	data, err := json.MarshalIndent(enc, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(c.Path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.Path, data, 0600)
+}
+
+// cipher returns cipher using key derived from the passphrase with function credentials were saved with.
+func (e *encryptedCredentials) cipher(passphrase string) (cipher.AEAD, error) {
+	if e.KDF != kdfArgon2id {
+		return nil, errors.New(fmt.Sprintf("Unknown key derivation function: %s", e.KDF))
+	}
+	block, err := aes.NewCipher(argon2.IDKey([]byte(passphrase), e.Salt, uint32(e.Rounds), e.Memory, e.Threads, keyLength))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// readPassphrase returns passphrase from environment, or asks user for it without echoing typed characters.
+func readPassphrase(prompt string) (string, error) {
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	return readSecret(bufio.NewReader(os.Stdin), prompt)
+}
+
+// readNewPassphrase asks user to choose passphrase for credentials file.
+func readNewPassphrase(reader *bufio.Reader) (string, error) {
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	passphrase, err := readSecret(reader, "Choose GoNote passphrase:")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("Passphrase can't be empty.")
+	}
+	confirm, err := readSecret(reader, "Repeat GoNote passphrase:")
+	if err != nil {
+		return "", err
+	}
+	if confirm != passphrase {
+		return "", errors.New("Passphrases do not match.")
+	}
+	return passphrase, nil
+}
+
+// readSecret asks user for secret value, hiding it while typed if possible.
+// Pressing Ctrl-C restores the terminal and cancels the prompt.
+func readSecret(reader *bufio.Reader, prompt string) (string, error) {
+	fmt.Fprintln(os.Stderr, prompt)
+	if restore, err := disableEcho(int(os.Stdin.Fd())); err == nil {
+		defer func() {
+			restore()
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+	var line string
+	var err error
+	done := make(chan struct{})
+	go func() {
+		line, err = reader.ReadString('\n')
+		close(done)
+	}()
+	select {
+	case <-signals:
+		return "", context.Canceled
+	case <-done:
+	}
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/exaroth/gonote/v2/simplenote"
+	"os"
+)
+
+// Exit codes, so scripts can tell failures apart.
+const (
+	exitError        = 1   // Any error not listed below
+	exitUsage        = 2   // Invalid command line arguments
+	exitUnauthorized = 3   // Credentials or access token rejected
+	exitNotFound     = 4   // Note or its version does not exist
+	exitConflict     = 5   // Note changed concurrently
+	exitRateLimited  = 6   // Too many requests sent to SimpleNote
+	exitNetwork      = 7   // SimpleNote could not be reached
+	exitInterrupted  = 130 // Cancelled with Ctrl-C, as in shells
+)
+
+// notFoundError describes note which does not exist, it matches simplenote.ErrNotFound.
+type notFoundError string
+
+func (e notFoundError) Error() string {
+	return string(e)
+}
+
+func (e notFoundError) Is(target error) bool {
+	return target == simplenote.ErrNotFound
+}
+
+// exitCode returns code program exits with after failing with given error.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case IsNetworkError(err):
+		return exitNetwork
+	case errors.Is(err, simplenote.ErrUnauthorized):
+		return exitUnauthorized
+	case errors.Is(err, simplenote.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, simplenote.ErrConflict):
+		return exitConflict
+	case errors.Is(err, simplenote.ErrRateLimited):
+		return exitRateLimited
+	}
+	return exitError
+}
+
+// errorMessage returns description of the error shown to the user. Bare API errors
+// only tell the status code, so they are replaced with explanation of what went wrong.
+func errorMessage(err error) string {
+	var apiErr *simplenote.APIError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "Interrupted."
+	case IsNetworkError(err):
+		return fmt.Sprintf("Could not reach SimpleNote, check your network connection: %s", err)
+	case !errors.As(err, &apiErr) || err != error(apiErr):
+		return err.Error()
+	case errors.Is(err, simplenote.ErrUnauthorized):
+		return "SimpleNote rejected the request, check your credentials or run `gonote logout` and try again."
+	case errors.Is(err, simplenote.ErrNotFound):
+		return "Note does not exist."
+	case errors.Is(err, simplenote.ErrConflict):
+		return "Note was changed elsewhere in the meantime, try again."
+	case errors.Is(err, simplenote.ErrRateLimited):
+		return "Too many requests sent to SimpleNote, wait a moment and try again."
+	}
+	return err.Error()
+}
+
+// exitWithError prints the error and ends the program with matching exit code.
+func exitWithError(err error, code int) {
+	fmt.Fprintln(os.Stderr, errorMessage(err))
+	os.Exit(code)
+}
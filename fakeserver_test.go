@@ -0,0 +1,356 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	fakeEmail    = "user@example.com"
+	fakePassword = "secret"
+)
+
+// fakeFailure is error injected into responses of the fake server.
+type fakeFailure struct {
+	Method string        // Method of failing requests, empty for any
+	Path   string        // Prefix of failing request paths, e.g. /api2/data
+	Status int           // Status code returned instead of the response, zero to only delay it
+	Delay  time.Duration // Time to wait before responding
+	Times  int           // Number of requests to fail, negative for all of them
+}
+
+// fakeFailureRetryAfter is Retry-After header sent with injected errors, so retries don't slow tests down.
+const fakeFailureRetryAfter = "0"
+
+// fakeSimpleNote is in-process SimpleNote server keeping every version of each note.
+type fakeSimpleNote struct {
+	*httptest.Server
+	mu       sync.Mutex
+	token    string
+	logins   int
+	keys     int
+	clock    int
+	noData   bool              // Whether index should leave note contents out even if asked for them
+	versions map[string][]Note // All versions of the notes, oldest first
+	failures []*fakeFailure
+	requests []string // Method and path of each received request
+}
+
+// newFakeSimpleNote starts fake server, which is stopped when the test finishes.
+func newFakeSimpleNote(t *testing.T) *fakeSimpleNote {
+	f := &fakeSimpleNote{
+		token:    "not-issued",
+		versions: make(map[string][]Note),
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// Fail injects failure into responses to matching requests.
+func (f *fakeSimpleNote) Fail(failure fakeFailure) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = append(f.failures, &failure)
+}
+
+// Recover removes all the injected failures.
+func (f *fakeSimpleNote) Recover() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = nil
+}
+
+// ExpireToken makes the server reject token given out so far.
+func (f *fakeSimpleNote) ExpireToken() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.token = fmt.Sprintf("token-%d", f.logins+2)
+}
+
+// Add stores note directly on the server, returning its key.
+func (f *fakeSimpleNote) Add(content string, tags ...string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := f.create(&Note{Content: content, Tags: tags, SystemTags: []string{}})
+	return n.Key
+}
+
+// Note returns current version of the note kept by the server.
+func (f *fakeSimpleNote) Note(key string) (Note, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	versions, ok := f.versions[key]
+	if !ok {
+		return Note{}, false
+	}
+	return versions[len(versions)-1], true
+}
+
+// Change updates the note directly on the server, as if it was edited elsewhere.
+func (f *fakeSimpleNote) Change(key, content string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, _ := f.current(key)
+	n.Content = content
+	n.ModifyDate = f.timestamp()
+	n.Version++
+	f.versions[key] = append(f.versions[key], n)
+}
+
+// OmitContent makes index leave note contents out, so every note has to be fetched separately.
+func (f *fakeSimpleNote) OmitContent() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.noData = true
+}
+
+// Count returns number of notes kept by the server, including trashed ones.
+func (f *fakeSimpleNote) Count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.versions)
+}
+
+// Requests returns number of received requests with given method and path prefix.
+func (f *fakeSimpleNote) Requests(method, prefix string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for _, r := range f.requests {
+		if strings.HasPrefix(r, method+" "+prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func (f *fakeSimpleNote) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	failure := f.failure(r)
+	f.mu.Unlock()
+	if failure != nil {
+		time.Sleep(failure.Delay)
+		if failure.Status != 0 {
+			w.Header().Set("Retry-After", fakeFailureRetryAfter)
+			w.WriteHeader(failure.Status)
+			return
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == "/api/login" {
+		f.login(w, r)
+		return
+	}
+	if r.URL.Query().Get("auth") != f.token || r.URL.Query().Get("email") != fakeEmail {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/api2/"), "/")
+	switch {
+	case path[0] == "index" && r.Method == http.MethodGet:
+		f.index(w, r.URL.Query())
+	case path[0] == "data" && len(path) == 1 && r.Method == http.MethodPost:
+		n := &Note{}
+		if err := json.NewDecoder(r.Body).Decode(n); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		created := f.create(n)
+		// SimpleNote does not send content back.
+		created.Content = ""
+		writeJSON(w, created)
+	case path[0] == "data" && len(path) == 2 && r.Method == http.MethodGet:
+		if n, ok := f.current(path[1]); ok {
+			writeJSON(w, n)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case path[0] == "data" && len(path) == 3 && r.Method == http.MethodGet:
+		version, _ := strconv.Atoi(path[2])
+		versions := f.versions[path[1]]
+		if version < 1 || version > len(versions) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		n := versions[version-1]
+		n.Key = ""
+		writeJSON(w, n)
+	case path[0] == "data" && len(path) == 2 && r.Method == http.MethodPost:
+		f.update(w, r, path[1])
+	case path[0] == "data" && len(path) == 2 && r.Method == http.MethodDelete:
+		n, ok := f.current(path[1])
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if n.Deleted != 1 {
+			// Only notes in trash can be deleted.
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		delete(f.versions, path[1])
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// failure returns failure injected for the request, if any.
+func (f *fakeSimpleNote) failure(r *http.Request) *fakeFailure {
+	for _, failure := range f.failures {
+		if failure.Times == 0 || (failure.Method != "" && failure.Method != r.Method) || !strings.HasPrefix(r.URL.Path, failure.Path) {
+			continue
+		}
+		if failure.Times > 0 {
+			failure.Times--
+		}
+		return failure
+	}
+	return nil
+}
+
+func (f *fakeSimpleNote) login(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	decoded, err := base64.StdEncoding.DecodeString(string(body))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	params, _ := url.ParseQuery(string(decoded))
+	if params.Get("email") != fakeEmail || params.Get("password") != fakePassword {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	f.logins++
+	f.token = fmt.Sprintf("token-%d", f.logins)
+	fmt.Fprint(w, f.token)
+}
+
+// index lists notes most recently modified first, mark being offset of the next page.
+func (f *fakeSimpleNote) index(w http.ResponseWriter, q url.Values) {
+	notes := Notes{}
+	since, _ := strconv.ParseFloat(q.Get("since"), 64)
+	for key := range f.versions {
+		n, _ := f.current(key)
+		if float64(GetSimpleNoteTimestamp(n.ModifyDate)) < since {
+			continue
+		}
+		if q.Get("data") != "true" || f.noData {
+			n.Content = ""
+		}
+		notes = append(notes, n)
+	}
+	sort.SliceStable(notes, func(i, j int) bool {
+		if notes[i].ModifyDate != notes[j].ModifyDate {
+			return notes[i].ModifyDate > notes[j].ModifyDate
+		}
+		return notes[i].Key < notes[j].Key
+	})
+	offset, _ := strconv.Atoi(q.Get("mark"))
+	length, err := strconv.Atoi(q.Get("length"))
+	if err != nil || length < 1 {
+		length = defaultNoteAmount
+	}
+	l := &NoteList{Data: []Note{}}
+	for i := offset; i < len(notes) && len(l.Data) < length; i++ {
+		l.Data = append(l.Data, notes[i])
+	}
+	if offset+length < len(notes) {
+		l.Mark = strconv.Itoa(offset + length)
+	}
+	l.Count = len(l.Data)
+	if q.Get("data") == "true" && !f.noData {
+		writeJSON(w, l)
+		return
+	}
+	// Content is left out completely, not just empty.
+	entries := []map[string]interface{}{}
+	for _, n := range l.Data {
+		data, _ := json.Marshal(n)
+		entry := map[string]interface{}{}
+		json.Unmarshal(data, &entry)
+		delete(entry, "content")
+		entries = append(entries, entry)
+	}
+	writeJSON(w, map[string]interface{}{"count": l.Count, "data": entries, "mark": l.Mark})
+}
+
+func (f *fakeSimpleNote) create(n *Note) Note {
+	f.keys++
+	n.Key = fmt.Sprintf("%x", md5.Sum([]byte(strconv.Itoa(f.keys))))
+	now := f.timestamp()
+	if n.CreateDate == "" {
+		n.CreateDate = now
+	}
+	n.ModifyDate = now
+	n.Version = 1
+	n.MinVersion = 1
+	n.SyncNum = 1
+	f.versions[n.Key] = []Note{*n}
+	return *n
+}
+
+func (f *fakeSimpleNote) update(w http.ResponseWriter, r *http.Request, key string) {
+	current, ok := f.current(key)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	n := &Note{}
+	if err := json.NewDecoder(r.Body).Decode(n); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	n.Key = key
+	n.CreateDate = current.CreateDate
+	n.ModifyDate = f.timestamp()
+	n.MinVersion = current.MinVersion
+	n.SyncNum = current.SyncNum + 1
+	n.Version = current.Version
+	if n.Content != current.Content || strings.Join(n.Tags, ",") != strings.Join(current.Tags, ",") {
+		n.Version++
+	}
+	if n.Version == current.Version {
+		f.versions[key][len(f.versions[key])-1] = *n
+	} else {
+		f.versions[key] = append(f.versions[key], *n)
+	}
+	writeJSON(w, n)
+}
+
+func (f *fakeSimpleNote) current(key string) (Note, bool) {
+	versions, ok := f.versions[key]
+	if !ok {
+		return Note{}, false
+	}
+	n := versions[len(versions)-1]
+	n.Tags = append([]string{}, n.Tags...)
+	return n, true
+}
+
+// timestamp returns modification date later than any given before, so notes
+// changed one after another are ordered even within the same second.
+func (f *fakeSimpleNote) timestamp() string {
+	f.clock++
+	return fmt.Sprintf("%d.%06d", 1665000000+f.clock, 0)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fatih/color"
+	"io"
+	"strings"
+	"text/template"
+)
+
+var (
+	// Colours available in output templates with color function.
+	templateColors = map[string]color.Attribute{
+		"black":   color.FgBlack,
+		"red":     color.FgRed,
+		"green":   color.FgGreen,
+		"yellow":  color.FgYellow,
+		"blue":    color.FgBlue,
+		"magenta": color.FgMagenta,
+		"cyan":    color.FgCyan,
+		"white":   color.FgWhite,
+	}
+
+	// Helper functions available in output templates.
+	templateFuncs = template.FuncMap{
+		"date":     HumanDate,
+		"tags":     ParseTags,
+		"truncate": truncate,
+		"join":     strings.Join,
+		"color":    colorize,
+		"red":      redColored,
+		"blue":     blueColored,
+		"cyan":     cyanColored,
+	}
+)
+
+// templateNote is data passed to output templates, note fields together with ones derived from them.
+type templateNote struct {
+	Note
+	Title string // First non empty line of the note
+	Body  string // Note content without leading empty lines
+}
+
+// noteTemplate renders notes using Go template defined by the user.
+type noteTemplate struct {
+	tmpl *template.Template
+}
+
+// newNoteTemplate parses user defined output template.
+func newNoteTemplate(format string) (*noteTemplate, error) {
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid output template: %s", err))
+	}
+	return &noteTemplate{tmpl: tmpl}, nil
+}
+
+// Render writes the note using the template, followed by new line.
+func (t *noteTemplate) Render(w io.Writer, n *Note) error {
+	lines := noteLines(n)
+	data := &templateNote{
+		Note:  *n,
+		Title: lines[0],
+		Body:  strings.Join(lines, "\n"),
+	}
+	if err := t.tmpl.Execute(w, data); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// truncate shortens the text to at most n characters, marking cut with ellipsis.
+func truncate(n int, s string) string {
+	r := []rune(s)
+	if n < 0 || len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "..."
+}
+
+// colorize paints the text in colour with given name.
+func colorize(name string, s interface{}) (string, error) {
+	attr, ok := templateColors[name]
+	if !ok {
+		return "", errors.New(fmt.Sprintf("Unknown colour: %s", name))
+	}
+	return color.New(attr).Sprint(s), nil
+}
@@ -2,10 +2,13 @@ module github.com/exaroth/gonote/v2
 
 go 1.19
 
-require github.com/fatih/color v1.13.0
+require (
+	github.com/fatih/color v1.13.0
+	golang.org/x/crypto v0.24.0
+	golang.org/x/sys v0.21.0
+)
 
 require (
 	github.com/mattn/go-colorable v0.1.9 // indirect
 	github.com/mattn/go-isatty v0.0.14 // indirect
-	golang.org/x/sys v0.0.0-20210630005230-0f9fa26af87c // indirect
 )
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultIndexPath = "~/.gonote/index.json"
+	indexVersion     = 2 // Bumped whenever stemming changes, older indexes are rebuilt
+)
+
+// indexedNote holds note fields kept in the search index.
+type indexedNote struct {
+	Tags       []string `json:"tags"`
+	ModifyDate string   `json:"modifydate"`
+	Deleted    int      `json:"deleted,omitempty"`
+	Title      string   `json:"title,omitempty"` // Note header, shown by shell completion
+	Terms      []string `json:"terms"`           // Unique stemmed terms of the note, used when removing it from postings
+}
+
+// searchIndex is persistent inverted index of note contents, mapping stemmed
+// terms to notes containing them, so queries don't have to scan every note.
+// All the methods are safe to call on nil index.
+type searchIndex struct {
+	Path     string                    `json:"-"`
+	Version  int                       `json:"version"`
+	Docs     map[string]*indexedNote   `json:"docs"`
+	Postings map[string]map[string]int `json:"postings"` // Term frequency for every note containing the term
+	loaded   bool
+	dirty    bool
+}
+
+// newSearchIndex returns index saved in given file.
+func newSearchIndex(path string) *searchIndex {
+	return &searchIndex{
+		Path:     path,
+		Version:  indexVersion,
+		Docs:     make(map[string]*indexedNote),
+		Postings: make(map[string]map[string]int),
+	}
+}
+
+// load reads index from disk once, missing file means empty index.
+func (idx *searchIndex) load() error {
+	if idx.loaded {
+		return nil
+	}
+	data, err := ioutil.ReadFile(idx.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		idx.Version = 0
+		if err = json.Unmarshal(data, idx); err != nil {
+			return err
+		}
+	}
+	if idx.Version != indexVersion {
+		// Terms were stemmed differently, start over so every note gets reindexed.
+		*idx = *newSearchIndex(idx.Path)
+		idx.dirty = true
+	}
+	idx.loaded = true
+	return nil
+}
+
+// Save writes index to disk if it changed, replacing the file atomically.
+func (idx *searchIndex) Save() error {
+	if idx == nil || !idx.dirty {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(idx.Path), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	tmp := idx.Path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	idx.dirty = false
+	return os.Rename(tmp, idx.Path)
+}
+
+// Doc returns indexed fields of the note with given key.
+func (idx *searchIndex) Doc(key string) (*indexedNote, bool) {
+	if idx == nil || idx.load() != nil {
+		return nil, false
+	}
+	d, ok := idx.Docs[key]
+	return d, ok
+}
+
+// All returns index entries of all indexed notes, without their contents.
+func (idx *searchIndex) All() Notes {
+	notes := Notes{}
+	if idx == nil || idx.load() != nil {
+		return notes
+	}
+	for k, d := range idx.Docs {
+		notes = append(notes, Note{Key: k, Tags: d.Tags, ModifyDate: d.ModifyDate, Deleted: d.Deleted})
+	}
+	return notes
+}
+
+// Stale reports whether the note changed since it was indexed, given its store index entry.
+func (idx *searchIndex) Stale(entry *Note) bool {
+	d, ok := idx.Doc(entry.Key)
+	return idx != nil && (!ok || d.ModifyDate != entry.ModifyDate || d.Deleted != entry.Deleted)
+}
+
+// Add indexes the note, replacing its previous entry.
+func (idx *searchIndex) Add(n *Note) error {
+	if idx == nil || n.Key == "" {
+		return nil
+	}
+	if err := idx.load(); err != nil {
+		return err
+	}
+	idx.remove(n.Key)
+	freq := make(map[string]int)
+	for _, t := range Tokenize(n.Content) {
+		if !isStopWord(t.Text) {
+			freq[Stem(t.Text)]++
+		}
+	}
+	d := &indexedNote{
+		Tags:       nonNilStrings(n.Tags),
+		ModifyDate: n.ModifyDate,
+		Deleted:    n.Deleted,
+		Title:      noteHeader(n),
+		Terms:      make([]string, 0, len(freq)),
+	}
+	for term, count := range freq {
+		if idx.Postings[term] == nil {
+			idx.Postings[term] = make(map[string]int)
+		}
+		idx.Postings[term][n.Key] = count
+		d.Terms = append(d.Terms, term)
+	}
+	idx.Docs[n.Key] = d
+	idx.dirty = true
+	return nil
+}
+
+// Trash marks indexed note as deleted.
+func (idx *searchIndex) Trash(key string) error {
+	if idx == nil {
+		return nil
+	}
+	if err := idx.load(); err != nil {
+		return err
+	}
+	if d, ok := idx.Docs[key]; ok && d.Deleted != 1 {
+		d.Deleted = 1
+		idx.dirty = true
+	}
+	return nil
+}
+
+// Remove drops the note from the index.
+func (idx *searchIndex) Remove(key string) error {
+	if idx == nil {
+		return nil
+	}
+	if err := idx.load(); err != nil {
+		return err
+	}
+	idx.remove(key)
+	return nil
+}
+
+// Prune removes notes which are no longer present in the store index.
+func (idx *searchIndex) Prune(index Notes) error {
+	if idx == nil {
+		return nil
+	}
+	if err := idx.load(); err != nil {
+		return err
+	}
+	present := make(map[string]bool, len(index))
+	for _, n := range index {
+		present[n.Key] = true
+	}
+	for k := range idx.Docs {
+		if !present[k] {
+			idx.remove(k)
+		}
+	}
+	return nil
+}
+
+// Lookup returns keys of notes containing given stemmed term.
+func (idx *searchIndex) Lookup(term string) map[string]bool {
+	keys := make(map[string]bool)
+	if idx == nil || idx.load() != nil {
+		return keys
+	}
+	for k := range idx.Postings[term] {
+		keys[k] = true
+	}
+	return keys
+}
+
+// Filter returns keys of notes which indexed fields satisfy given condition.
+func (idx *searchIndex) Filter(match func(d *indexedNote) bool) map[string]bool {
+	keys := make(map[string]bool)
+	if idx == nil || idx.load() != nil {
+		return keys
+	}
+	for k, d := range idx.Docs {
+		if match(d) {
+			keys[k] = true
+		}
+	}
+	return keys
+}
+
+func (idx *searchIndex) remove(key string) {
+	d, ok := idx.Docs[key]
+	if !ok {
+		return
+	}
+	for _, term := range d.Terms {
+		delete(idx.Postings[term], key)
+		if len(idx.Postings[term]) == 0 {
+			delete(idx.Postings, term)
+		}
+	}
+	delete(idx.Docs, key)
+	idx.dirty = true
+}
+
+// Token represents single word found in the text, with its position.
+type Token struct {
+	Text  string // Lowercased word
+	Start int
+	End   int
+}
+
+// Tokenize splits text into lowercased words made of letters and digits.
+func Tokenize(text string) []Token {
+	tokens := []Token{}
+	start := -1
+	for i, r := range text {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if word && start == -1 {
+			start = i
+		} else if !word && start != -1 {
+			tokens = append(tokens, Token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start != -1 {
+		tokens = append(tokens, Token{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return tokens
+}
+
+// Common English words left out of the index, they match nearly every note.
+var stopWords = map[string]bool{
+	"a": true, "about": true, "after": true, "all": true, "also": true, "an": true,
+	"and": true, "any": true, "are": true, "as": true, "at": true, "be": true,
+	"been": true, "but": true, "by": true, "can": true, "could": true, "did": true,
+	"do": true, "does": true, "for": true, "from": true, "had": true, "has": true,
+	"have": true, "he": true, "her": true, "his": true, "how": true, "i": true,
+	"if": true, "in": true, "into": true, "is": true, "it": true, "its": true,
+	"me": true, "my": true, "no": true, "not": true, "of": true, "on": true,
+	"or": true, "our": true, "she": true, "so": true, "than": true, "that": true,
+	"the": true, "their": true, "them": true, "then": true, "there": true, "these": true,
+	"they": true, "this": true, "those": true, "to": true, "too": true, "up": true,
+	"us": true, "was": true, "we": true, "were": true, "what": true, "when": true,
+	"where": true, "which": true, "who": true, "will": true, "with": true, "would": true,
+	"you": true, "your": true,
+}
+
+// isStopWord reports whether lowercased word is too common to be indexed.
+func isStopWord(word string) bool {
+	return stopWords[word]
+}
+
+// Stem reduces lowercased word to its stem using Porter algorithm, so different
+// forms of the word (e.g. "meeting" and "meetings") match each other.
+// Words with letters outside of a-z, or digits, are returned unchanged.
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+	s := &porterStemmer{b: []byte(word)}
+	s.step1()
+	s.step2()
+	s.step3()
+	s.step4()
+	s.step5()
+	return string(s.b)
+}
+
+// porterStemmer holds the word being stemmed.
+type porterStemmer struct {
+	b []byte
+}
+
+// cons reports whether i-th letter is a consonant.
+func (s *porterStemmer) cons(i int) bool {
+	switch s.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !s.cons(i-1)
+	}
+	return true
+}
+
+// measure returns number of vowel-consonant sequences in first n letters.
+func (s *porterStemmer) measure(n int) int {
+	m, i := 0, 0
+	for i < n && s.cons(i) {
+		i++
+	}
+	for i < n {
+		for i < n && !s.cons(i) {
+			i++
+		}
+		if i == n {
+			break
+		}
+		for i < n && s.cons(i) {
+			i++
+		}
+		m++
+	}
+	return m
+}
+
+// hasVowel reports whether first n letters contain a vowel.
+func (s *porterStemmer) hasVowel(n int) bool {
+	for i := 0; i < n; i++ {
+		if !s.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doubleCons reports whether first n letters end with a double consonant.
+func (s *porterStemmer) doubleCons(n int) bool {
+	return n >= 2 && s.b[n-1] == s.b[n-2] && s.cons(n-1)
+}
+
+// cvc reports whether first n letters end with consonant-vowel-consonant,
+// where the last consonant is not w, x or y, e.g. "hop".
+func (s *porterStemmer) cvc(n int) bool {
+	return n >= 3 && s.cons(n-3) && !s.cons(n-2) && s.cons(n-1) && !strings.ContainsRune("wxy", rune(s.b[n-1]))
+}
+
+func (s *porterStemmer) ends(suffix string) bool {
+	return strings.HasSuffix(string(s.b), suffix)
+}
+
+// replace swaps suffix for repl if the rest of the word has measure greater than m.
+// It reports whether the word ends with suffix, whether or not it got replaced.
+func (s *porterStemmer) replace(suffix, repl string, m int) bool {
+	if !s.ends(suffix) {
+		return false
+	}
+	if n := len(s.b) - len(suffix); s.measure(n) > m {
+		s.b = append(s.b[:n], repl...)
+	}
+	return true
+}
+
+// step1 removes plurals, -ed and -ing endings and turns terminal y into i.
+func (s *porterStemmer) step1() {
+	switch {
+	case s.ends("sses"), s.ends("ies"):
+		s.b = s.b[:len(s.b)-2]
+	case s.ends("ss"):
+	case s.ends("s"):
+		s.b = s.b[:len(s.b)-1]
+	}
+	if s.ends("eed") {
+		s.replace("eed", "ee", 0)
+	} else {
+		for _, suffix := range []string{"ed", "ing"} {
+			n := len(s.b) - len(suffix)
+			if !s.ends(suffix) || !s.hasVowel(n) {
+				continue
+			}
+			s.b = s.b[:n]
+			switch {
+			case s.ends("at"), s.ends("bl"), s.ends("iz"):
+				s.b = append(s.b, 'e')
+			case s.doubleCons(n) && !strings.ContainsRune("lsz", rune(s.b[n-1])):
+				s.b = s.b[:n-1]
+			case s.measure(n) == 1 && s.cvc(n):
+				s.b = append(s.b, 'e')
+			}
+			break
+		}
+	}
+	if n := len(s.b) - 1; s.ends("y") && s.hasVowel(n) {
+		s.b[n] = 'i'
+	}
+}
+
+// Suffixes replaced by step2 and step3, longest first where they overlap.
+var (
+	step2Suffixes = [][2]string{
+		{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"},
+		{"izer", "ize"}, {"bli", "ble"}, {"alli", "al"}, {"entli", "ent"},
+		{"eli", "e"}, {"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"},
+		{"ator", "ate"}, {"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"},
+		{"ousness", "ous"}, {"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+		{"logi", "log"},
+	}
+	step3Suffixes = [][2]string{
+		{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+		{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+	}
+	step4Suffixes = []string{
+		"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment",
+		"ent", "ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize",
+	}
+)
+
+// step2 maps double suffixes to single ones, "-ization" to "-ize" and so on.
+func (s *porterStemmer) step2() {
+	for _, r := range step2Suffixes {
+		if s.replace(r[0], r[1], 0) {
+			return
+		}
+	}
+}
+
+// step3 handles -ic-, -full, -ness etc.
+func (s *porterStemmer) step3() {
+	for _, r := range step3Suffixes {
+		if s.replace(r[0], r[1], 0) {
+			return
+		}
+	}
+}
+
+// step4 removes -ant, -ence etc. from words long enough.
+func (s *porterStemmer) step4() {
+	for _, suffix := range step4Suffixes {
+		if !s.ends(suffix) {
+			continue
+		}
+		n := len(s.b) - len(suffix)
+		if suffix == "ion" && (n == 0 || (s.b[n-1] != 's' && s.b[n-1] != 't')) {
+			return
+		}
+		if s.measure(n) > 1 {
+			s.b = s.b[:n]
+		}
+		return
+	}
+}
+
+// step5 removes final -e and undoubles final -ll in longer words.
+func (s *porterStemmer) step5() {
+	n := len(s.b)
+	if s.ends("e") {
+		if m := s.measure(n - 1); m > 1 || (m == 1 && !s.cvc(n-1)) {
+			s.b = s.b[:n-1]
+			n--
+		}
+	}
+	if s.measure(n) > 1 && s.doubleCons(n) && s.b[n-1] == 'l' {
+		s.b = s.b[:n-1]
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	tests := []struct {
+		word string
+		stem string
+	}{
+		{"note", "note"},
+		{"notes", "note"},
+		{"date", "date"},
+		{"dates", "date"},
+		{"news", "new"},
+		{"this", "thi"},
+		{"meeting", "meet"},
+		{"meetings", "meet"},
+		{"meets", "meet"},
+		{"running", "run"},
+		{"stopped", "stop"},
+		{"hoping", "hope"},
+		{"caresses", "caress"},
+		{"ponies", "poni"},
+		{"agreed", "agre"},
+		{"happy", "happi"},
+		{"happiness", "happi"},
+		{"relational", "relat"},
+		{"connection", "connect"},
+		{"connected", "connect"},
+		{"generalization", "gener"},
+		{"controlling", "control"},
+		{"ok", "ok"},
+		{"mp3s", "mp3s"},
+		{"café", "café"},
+	}
+	for _, tt := range tests {
+		if got := Stem(tt.word); got != tt.stem {
+			t.Errorf("Stem(%q) = %q, want %q", tt.word, got, tt.stem)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text   string
+		tokens []Token
+	}{
+		{"", nil},
+		{"  \n", nil},
+		{"Hello", []Token{{"hello", 0, 5}}},
+		{"Buy milk, eggs!", []Token{{"buy", 0, 3}, {"milk", 4, 8}, {"eggs", 10, 14}}},
+		{"e-mail x2", []Token{{"e", 0, 1}, {"mail", 2, 6}, {"x2", 7, 9}}},
+		{"Żółw café", []Token{{"żółw", 0, 7}, {"café", 8, 13}}},
+	}
+	for _, tt := range tests {
+		got := Tokenize(tt.text)
+		if len(got) == 0 && len(tt.tokens) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.tokens) {
+			t.Errorf("Tokenize(%q) = %v, want %v", tt.text, got, tt.tokens)
+		}
+	}
+}
+
+func TestIndexSkipsStopWords(t *testing.T) {
+	idx := newSearchIndex(filepath.Join(t.TempDir(), "index.json"))
+	if err := idx.Add(&Note{Key: "k", Content: "This is the note about notes"}); err != nil {
+		t.Fatal(err)
+	}
+	for term, want := range map[string]bool{"the": false, "thi": false, "note": true} {
+		if got := idx.Lookup(term)["k"]; got != want {
+			t.Errorf("Lookup(%q) found note: %v, want %v", term, got, want)
+		}
+	}
+}
+
+func TestIndexRebuiltOnVersionChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.json")
+	old := `{"docs":{"k":{"tags":[],"modifydate":"1","terms":["not"]}},"postings":{"not":{"k":1}}}`
+	if err := ioutil.WriteFile(path, []byte(old), 0600); err != nil {
+		t.Fatal(err)
+	}
+	idx := newSearchIndex(path)
+	if _, ok := idx.Doc("k"); ok {
+		t.Error("Notes indexed with older stemmer were kept")
+	}
+	if !idx.Stale(&Note{Key: "k", ModifyDate: "1"}) {
+		t.Error("Note is not reindexed after index version change")
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	localNoteExtension   = ".md"
+	localVersionsDir     = ".versions" // Directory holding snapshots of previous note versions
+	frontMatterSeparator = "---"
+)
+
+// localStore is NoteStore implementation keeping every note as a Markdown file
+// with front-matter holding note metadata, no account needed.
+// Each saved version of the note is also kept as a snapshot, so it can be restored.
+type localStore struct {
+	Dir          string
+	listing      Notes   // Notes read for the index, newest first
+	listingSince float64 // Since option the listing was read with
+}
+
+// newLocalStore returns store keeping notes in given directory.
+func newLocalStore(dir string) NoteStore {
+	return &localStore{
+		Dir: dir,
+	}
+}
+
+// Authorize makes sure notes directory exists, there is nothing to log into.
+func (l *localStore) Authorize() error {
+	return os.MkdirAll(l.Dir, 0700)
+}
+
+// Logout does nothing, local notes need no session.
+func (l *localStore) Logout() error {
+	return nil
+}
+
+// Create saves new note under freshly generated key.
+func (l *localStore) Create(n *Note) (*Note, error) {
+	key, err := GenerateNoteKey()
+	if err != nil {
+		return nil, err
+	}
+	newNote := *n
+	newNote.Key = key
+	now := SimpleNoteTimestamp(time.Now())
+	if newNote.CreateDate == "" {
+		newNote.CreateDate = now
+	}
+	newNote.ModifyDate = now
+	newNote.Version = 1
+	if err = l.save(&newNote); err != nil {
+		return nil, err
+	}
+	return &newNote, nil
+}
+
+// Fetch reads note with given key from disk.
+func (l *localStore) Fetch(key string) (*Note, error) {
+	return l.read(key)
+}
+
+// FetchVersion reads snapshot of the note in given version.
+func (l *localStore) FetchVersion(key string, version int) (*Note, error) {
+	data, err := ioutil.ReadFile(l.versionPath(key, version))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, notFoundError(fmt.Sprintf("Version %d of note %s does not exist.", version, key))
+		}
+		return nil, err
+	}
+	n, err := UnmarshalNoteFile(data)
+	if err != nil {
+		return nil, err
+	}
+	n.Key = key
+	return n, nil
+}
+
+// Update overwrites existing note with given values, as its next version.
+func (l *localStore) Update(n *Note) error {
+	existing, err := l.read(n.Key)
+	if err != nil {
+		return err
+	}
+	updated := *n
+	updated.ModifyDate = SimpleNoteTimestamp(time.Now())
+	updated.Version = existing.Version + 1
+	return l.save(&updated)
+}
+
+// Trash marks the note as deleted, keeping it on disk.
+func (l *localStore) Trash(key string) error {
+	n, err := l.read(key)
+	if err != nil {
+		return err
+	}
+	n.Deleted = 1
+	return l.Update(n)
+}
+
+// Purge removes note file permanently, together with its previous versions.
+func (l *localStore) Purge(key string) error {
+	l.listing = nil
+	if err := os.Remove(l.notePath(key)); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(l.Dir, localVersionsDir, key))
+}
+
+// Index returns page of notes stored in the directory, mark being offset of the next page.
+// Notes are listed most recently modified first, the same way SimpleNote does, always with
+// their content as whole files are read anyway. Whole listing
+// is read when first page is requested, following pages are served from it unless notes
+// were written in the meantime.
+func (l *localStore) Index(mark string, length int, opts IndexOptions) (*NoteList, error) {
+	offset := 0
+	if mark != "" {
+		var err error
+		if offset, err = strconv.Atoi(mark); err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid index mark: %s", mark))
+		}
+	}
+	if mark == "" || l.listing == nil || l.listingSince != opts.Since {
+		if err := l.readListing(opts.Since); err != nil {
+			return nil, err
+		}
+	}
+	list := &NoteList{Data: []Note{}, WithContent: make(map[string]bool)}
+	for i := offset; i < len(l.listing); i++ {
+		if len(list.Data) == length {
+			list.Mark = strconv.Itoa(i)
+			break
+		}
+		list.Data = append(list.Data, l.listing[i])
+		list.WithContent[l.listing[i].Key] = true
+	}
+	list.Count = len(list.Data)
+	return list, nil
+}
+
+// readListing reads all the notes modified after given timestamp, newest first.
+func (l *localStore) readListing(since float64) error {
+	keys, err := l.keys()
+	if err != nil {
+		return err
+	}
+	l.listing, l.listingSince = Notes{}, since
+	for _, key := range keys {
+		n, err := l.read(key)
+		if err != nil {
+			return err
+		}
+		if since > 0 && float64(GetSimpleNoteTimestamp(n.ModifyDate)) < since {
+			continue
+		}
+		l.listing = append(l.listing, *n)
+	}
+	sort.Stable(sort.Reverse(l.listing))
+	return nil
+}
+
+// keys returns sorted keys of all the notes in the directory.
+func (l *localStore) keys() ([]string, error) {
+	files, err := ioutil.ReadDir(l.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	keys := []string{}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != localNoteExtension {
+			continue
+		}
+		keys = append(keys, strings.TrimSuffix(f.Name(), localNoteExtension))
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (l *localStore) notePath(key string) string {
+	return filepath.Join(l.Dir, key+localNoteExtension)
+}
+
+func (l *localStore) versionPath(key string, version int) string {
+	return filepath.Join(l.Dir, localVersionsDir, key, strconv.Itoa(version)+localNoteExtension)
+}
+
+// save writes the note and keeps snapshot of its current version.
+func (l *localStore) save(n *Note) error {
+	if err := l.write(n); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.versionPath(n.Key, n.Version)), 0700); err != nil {
+		return err
+	}
+	data, err := MarshalNoteFile(n)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(l.versionPath(n.Key, n.Version), data, 0600)
+}
+
+// write saves note to disk, replacing the file atomically.
+func (l *localStore) write(n *Note) error {
+	l.listing = nil
+	if err := os.MkdirAll(l.Dir, 0700); err != nil {
+		return err
+	}
+	data, err := MarshalNoteFile(n)
+	if err != nil {
+		return err
+	}
+	tmp := l.notePath(n.Key) + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.notePath(n.Key))
+}
+
+// read loads note with given key from disk.
+func (l *localStore) read(key string) (*Note, error) {
+	data, err := ioutil.ReadFile(l.notePath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, notFoundError(fmt.Sprintf("Note %s does not exist.", key))
+		}
+		return nil, err
+	}
+	n, err := UnmarshalNoteFile(data)
+	if err != nil {
+		return nil, err
+	}
+	n.Key = key
+	return n, nil
+}
+
+// MarshalNoteFile encodes note as Markdown body preceded by front-matter.
+// List values are written as JSON arrays, which are also valid YAML.
+func MarshalNoteFile(n *Note) ([]byte, error) {
+	tags, err := json.Marshal(nonNilStrings(n.Tags))
+	if err != nil {
+		return nil, err
+	}
+	systemTags, err := json.Marshal(nonNilStrings(n.SystemTags))
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, frontMatterSeparator)
+	fmt.Fprintf(buf, "tags: %s\n", tags)
+	fmt.Fprintf(buf, "systemtags: %s\n", systemTags)
+	fmt.Fprintf(buf, "deleted: %d\n", n.Deleted)
+	fmt.Fprintf(buf, "createdate: %s\n", n.CreateDate)
+	fmt.Fprintf(buf, "modifydate: %s\n", n.ModifyDate)
+	fmt.Fprintf(buf, "version: %d\n", n.Version)
+	fmt.Fprintf(buf, "syncnum: %d\n", n.SyncNum)
+	fmt.Fprintln(buf, frontMatterSeparator)
+	buf.WriteString(n.Content)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalNoteFile decodes note saved with MarshalNoteFile.
+func UnmarshalNoteFile(data []byte) (*Note, error) {
+	n := &Note{Tags: []string{}, SystemTags: []string{}}
+	reader := bufio.NewReader(bytes.NewReader(data))
+	line, err := reader.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != frontMatterSeparator {
+		return nil, errors.New("Missing note front-matter")
+	}
+	for {
+		line, err = reader.ReadString('\n')
+		if err != nil {
+			return nil, errors.New("Unterminated note front-matter")
+		}
+		line = strings.TrimSpace(line)
+		if line == frontMatterSeparator {
+			break
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.New(fmt.Sprintf("Invalid front-matter line: %s", line))
+		}
+		name, val := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch name {
+		case "tags":
+			err = json.Unmarshal([]byte(val), &n.Tags)
+		case "systemtags":
+			err = json.Unmarshal([]byte(val), &n.SystemTags)
+		case "deleted":
+			n.Deleted, err = strconv.Atoi(val)
+		case "createdate":
+			n.CreateDate = val
+		case "modifydate":
+			n.ModifyDate = val
+		case "version":
+			n.Version, err = strconv.Atoi(val)
+		case "syncnum":
+			n.SyncNum, err = strconv.Atoi(val)
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid front-matter value for %s: %s", name, val))
+		}
+	}
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	n.Content = string(content)
+	return n, nil
+}
+
+// GenerateNoteKey returns random key in the same format SimpleNote uses.
+func GenerateNoteKey() (string, error) {
+	b := make([]byte, SimpleNoteKeyLength/2)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/exaroth/gonote/v2/simplenote"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNoteFileRoundTrip(t *testing.T) {
+	notes := []*Note{
+		{Tags: []string{}, SystemTags: []string{}},
+		{
+			Content:    "Title\n---\nnot front-matter\n---\n",
+			Tags:       []string{"work", "a b"},
+			SystemTags: []string{"markdown", "pinned"},
+			Deleted:    1,
+			CreateDate: "1665000000.000000",
+			ModifyDate: "1665000001.500000",
+			Version:    3,
+			SyncNum:    7,
+		},
+		{Content: "---\nstarts with separator", Tags: []string{}, SystemTags: []string{}},
+	}
+	for _, n := range notes {
+		data, err := MarshalNoteFile(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := UnmarshalNoteFile(data)
+		if err != nil {
+			t.Fatalf("Could not decode %q: %s", data, err)
+		}
+		if !reflect.DeepEqual(decoded, n) {
+			t.Errorf("Decoded note differs:\n%+v\nwant:\n%+v", decoded, n)
+		}
+	}
+}
+
+func TestUnmarshalInvalidNoteFile(t *testing.T) {
+	for _, data := range []string{"", "no front-matter", "---\ntags: []\n", "---\nversion: x\n---\n"} {
+		if _, err := UnmarshalNoteFile([]byte(data)); err == nil {
+			t.Errorf("Expected error decoding %q", data)
+		}
+	}
+}
+
+func TestLocalStoreVersions(t *testing.T) {
+	l := &localStore{Dir: t.TempDir()}
+	n, err := l.Create(&Note{Content: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Content = "second"
+	if err = l.Update(n); err != nil {
+		t.Fatal(err)
+	}
+	old, err := l.FetchVersion(n.Key, 1)
+	if err != nil || old.Content != "first" || old.Key != n.Key {
+		t.Fatalf("Unexpected first version: %+v, %v", old, err)
+	}
+	// Restoring writes old content as the next version.
+	if err = l.Update(old); err != nil {
+		t.Fatal(err)
+	}
+	current, err := l.Fetch(n.Key)
+	if err != nil || current.Content != "first" || current.Version != 3 {
+		t.Fatalf("Unexpected restored note: %+v, %v", current, err)
+	}
+	if v, err := l.FetchVersion(n.Key, 2); err != nil || v.Content != "second" {
+		t.Errorf("Unexpected second version: %+v, %v", v, err)
+	}
+	if _, err = l.FetchVersion(n.Key, 4); !errors.Is(err, simplenote.ErrNotFound) {
+		t.Errorf("Expected missing version to be not found, got %v", err)
+	}
+}
+
+func TestLocalStoreTrashAndPurge(t *testing.T) {
+	l := &localStore{Dir: t.TempDir()}
+	n, err := l.Create(&Note{Content: "note"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = l.Trash(n.Key); err != nil {
+		t.Fatal(err)
+	}
+	trashed, err := l.Fetch(n.Key)
+	if err != nil || trashed.Deleted != 1 || trashed.Content != "note" {
+		t.Fatalf("Unexpected trashed note: %+v, %v", trashed, err)
+	}
+	if err = l.Purge(n.Key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = l.Fetch(n.Key); !errors.Is(err, simplenote.ErrNotFound) {
+		t.Errorf("Expected purged note to be not found, got %v", err)
+	}
+	if _, err = l.FetchVersion(n.Key, 1); !errors.Is(err, simplenote.ErrNotFound) {
+		t.Errorf("Expected versions of purged note to be removed, got %v", err)
+	}
+	if err = l.Trash(n.Key); !errors.Is(err, simplenote.ErrNotFound) {
+		t.Errorf("Expected trashing purged note to fail, got %v", err)
+	}
+}
+
+func TestLocalStoreIndex(t *testing.T) {
+	l := &localStore{Dir: t.TempDir()}
+	for i := 1; i <= 5; i++ {
+		n := &Note{Key: fmt.Sprintf("note%d", i), Content: "content", ModifyDate: fmt.Sprintf("166500000%d.000000", i)}
+		if err := l.write(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	walk := func(opts IndexOptions) (string, int) {
+		keys, pages, mark := []string{}, 0, ""
+		for {
+			list, err := l.Index(mark, 2, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pages++
+			for _, n := range list.Data {
+				keys = append(keys, n.Key)
+			}
+			if list.Mark == "" {
+				return strings.Join(keys, ","), pages
+			}
+			mark = list.Mark
+		}
+	}
+	if keys, pages := walk(IndexOptions{}); keys != "note5,note4,note3,note2,note1" || pages != 3 {
+		t.Errorf("Unexpected listing in %d pages: %s", pages, keys)
+	}
+	if keys, _ := walk(IndexOptions{Since: 1665000003}); keys != "note5,note4,note3" {
+		t.Errorf("Unexpected listing since third note: %s", keys)
+	}
+
+	// Notes written between pages are seen by the following ones.
+	first, err := l.Index("", 2, IndexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = l.Purge("note1"); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := l.Index(first.Mark, 10, IndexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest.Data) != 2 || rest.Data[1].Key != "note2" {
+		t.Errorf("Expected purged note to be left out, got %+v", rest.Data)
+	}
+	if _, err = l.Index("x", 2, IndexOptions{}); err == nil {
+		t.Error("Expected invalid mark to be rejected")
+	}
+}
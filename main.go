@@ -1,30 +1,95 @@
 package main
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
 )
 
 func main() {
 
 	var err error
 	config := NewConfigFile()
-	err = config.Load()
-	if err != nil {
-		log.Fatal(err)
+	if len(os.Args) > 1 && os.Args[1] == completeCommand {
+		complete(os.Stdout, config, os.Args[2:])
+		return
 	}
 	commandLineParser := newCommandLineParser(config)
 	params, err := commandLineParser.Grab()
 	if err != nil {
-		log.Fatal(err)
+		exitWithError(err, exitUsage)
+	}
+	switch params.Action {
+	case "help":
+		if err = showHelp(os.Stdout, params.Flags["command"]); err != nil {
+			exitWithError(err, exitUsage)
+		}
+		return
+	case "completion":
+		if err = printCompletionScript(os.Stdout, params.Flags["shell"]); err != nil {
+			exitWithError(err, exitUsage)
+		}
+		return
+	case "version":
+		fmt.Println(ListVersion())
+		return
+	}
+	// Configuration is created only once it's needed, so commands above work on fresh machine.
+	if params.Action == "profile" && params.Flags["command"] != "add" {
+		err = config.LoadExisting()
+	} else {
+		err = config.Load()
+	}
+	if err != nil {
+		exitWithError(err, exitCode(err))
+	}
+	if err = config.UseProfile(params.Flags["profile"]); err != nil {
+		exitWithError(err, exitCode(err))
+	}
+	if params.Action == "profile" {
+		if err = manageProfiles(config, params); err != nil {
+			exitWithError(err, exitCode(err))
+		}
+		return
 	}
 	if params.Content == "" && params.Action == "" {
 		// This happens when user did not enter anything in editor - don't send empty note then.
 		return
 	}
-	simpleNoteClient := newSimpleNoteClient(nil, config, params)
-	simpleNoteClient.Authorize()
+	ctx, cancel := interruptContext()
+	defer cancel()
+	store, err := newNoteStore(ctx, config)
+	if err != nil {
+		exitWithError(err, exitCode(err))
+	}
+	simpleNoteClient := newSimpleNoteClient(store, config, params)
+	// Network errors are left for the action to handle, so writes are queued while offline.
+	if err = simpleNoteClient.Authorize(); err != nil && !IsNetworkError(err) {
+		exitWithError(err, exitCode(err))
+	}
 	err = simpleNoteClient.Handle()
 	if err != nil {
-		log.Fatal(err)
+		exitWithError(err, exitCode(err))
+	}
+}
+
+// interruptContext returns context cancelled when user presses Ctrl-C, so pending
+// requests are stopped. Pressing it again kills the program right away.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		select {
+		case <-signals:
+			signal.Stop(signals)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
 	}
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	conflictLocalMarker  = "<<<<<<< local"
+	conflictSeparator    = "======="
+	conflictRemoteMarker = ">>>>>>> remote"
+)
+
+// MergeText performs line based three-way merge of local and remote changes made to base text.
+// Returns merged text and whether it merged cleanly, if not conflicting
+// parts are surrounded with conflict markers. Trailing whitespace of the texts
+// is ignored, as editors and note store may add or strip final newline.
+func MergeText(base, local, remote string) (string, bool) {
+	o, a, b := splitLines(base), splitLines(local), splitLines(remote)
+	matchA, matchB := matchLines(o, a), matchLines(o, b)
+	merged := []string{}
+	clean := true
+	i, ai, bi := 0, 0, 0
+	for {
+		// Copy lines unchanged in both versions.
+		for i < len(o) && matchA[i] == ai && matchB[i] == bi {
+			merged = append(merged, o[i])
+			i, ai, bi = i+1, ai+1, bi+1
+		}
+		if i == len(o) && ai == len(a) && bi == len(b) {
+			break
+		}
+		// Find next base line present in both versions, everything before it has changed.
+		j, aj, bj := i, len(a), len(b)
+		for ; j < len(o); j++ {
+			if matchA[j] >= ai && matchB[j] >= bi {
+				aj, bj = matchA[j], matchB[j]
+				break
+			}
+		}
+		oChunk, aChunk, bChunk := o[i:j], a[ai:aj], b[bi:bj]
+		switch {
+		case equalLines(aChunk, oChunk):
+			merged = append(merged, bChunk...)
+		case equalLines(bChunk, oChunk), equalLines(aChunk, bChunk):
+			merged = append(merged, aChunk...)
+		default:
+			clean = false
+			merged = append(merged, conflictLocalMarker)
+			merged = append(merged, aChunk...)
+			merged = append(merged, conflictSeparator)
+			merged = append(merged, bChunk...)
+			merged = append(merged, conflictRemoteMarker)
+		}
+		i, ai, bi = j, aj, bj
+	}
+	return strings.Join(merged, "\n"), clean
+}
+
+// matchLines returns longest common subsequence of both texts, as index of matching
+// line in the other text for every line of the base, -1 if it has no match.
+func matchLines(base, other []string) []int {
+	lcs := make([][]int, len(base)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(other)+1)
+	}
+	for i := len(base) - 1; i >= 0; i-- {
+		for j := len(other) - 1; j >= 0; j-- {
+			if base[i] == other[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	match := make([]int, len(base))
+	i, j := 0, 0
+	for i < len(base) {
+		if j < len(other) && base[i] == other[j] {
+			match[i] = j
+			i, j = i+1, j+1
+		} else if j < len(other) && lcs[i][j+1] > lcs[i+1][j] {
+			j++
+		} else {
+			match[i] = -1
+			i++
+		}
+	}
+	return match
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimRightFunc(s, unicode.IsSpace)
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, "\n")
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMergeText(t *testing.T) {
+	conflict := func(local, remote string) string {
+		return conflictLocalMarker + "\n" + local + "\n" + conflictSeparator + "\n" + remote + "\n" + conflictRemoteMarker
+	}
+	tests := []struct {
+		name                string
+		base, local, remote string
+		merged              string
+		clean               bool
+	}{
+		{"unchanged", "a\nb", "a\nb", "a\nb", "a\nb", true},
+		{"local change", "a\nb\nc", "a\nB\nc", "a\nb\nc", "a\nB\nc", true},
+		{"remote change", "a\nb\nc", "a\nb\nc", "a\nB\nc", "a\nB\nc", true},
+		{"same change", "a\nb\nc", "a\nB\nc", "a\nB\nc", "a\nB\nc", true},
+		{"separate changes", "a\nb\nc", "A\nb\nc", "a\nb\nC", "A\nb\nC", true},
+		{"local insert, remote delete", "a\nb\nc\nd", "a\nb\nc\nx\nd", "a\nc\nd", "a\nc\nx\nd", true},
+		{"trailing newline", "a\nb\n", "a\nB", "a\nb\n\n", "a\nB", true},
+		{"trailing newline with remote change", "a\nb\nc\n", "A\nb\nc", "a\nb\nC\n", "A\nb\nC", true},
+		{"conflict", "a\nb\nc", "a\nlocal\nc", "a\nremote\nc", "a\n" + conflict("local", "remote") + "\nc", false},
+		{"conflict at end", "a", "a\nlocal", "a\nremote", "a\n" + conflict("local", "remote"), false},
+		{"conflict without base", "", "local", "remote", conflict("local", "remote"), false},
+		{"local delete, remote change", "a\nb\nc", "a\nc", "a\nB\nc", "a\n" + conflictLocalMarker + "\n" + conflictSeparator + "\nB\n" + conflictRemoteMarker + "\nc", false},
+	}
+	for _, tt := range tests {
+		merged, clean := MergeText(tt.base, tt.local, tt.remote)
+		if merged != tt.merged || clean != tt.clean {
+			t.Errorf("%s: MergeText(%q, %q, %q) = %q, %v, want %q, %v", tt.name, tt.base, tt.local, tt.remote, merged, clean, tt.merged, tt.clean)
+		}
+	}
+}
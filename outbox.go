@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/exaroth/gonote/v2/simplenote"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultOutboxPath = "~/.gonote/outbox.json"
+
+	outboxCreate = "create"
+	outboxUpdate = "update"
+	outboxDelete = "delete"
+)
+
+// outboxEntry represents single write which could not be sent to note store.
+type outboxEntry struct {
+	ID          string `json:"id"`
+	Op          string `json:"op"`
+	Note        Note   `json:"note"`
+	Permanently bool   `json:"permanently,omitempty"`
+	Queued      string `json:"queued"`
+	Attempted   bool   `json:"attempted,omitempty"`   // Idempotency record, set before entry is sent as request may succeed without us seeing the response
+	BaseDate    string `json:"basedate,omitempty"`    // Modification date of the note queued update was made to
+	BaseVersion int    `json:"baseversion,omitempty"` // Version of the note queued update was made to
+}
+
+// outbox persists writes made while offline so they can be replayed later, in order.
+type outbox struct {
+	Path    string        `json:"-"`
+	Entries []outboxEntry `json:"entries"`
+}
+
+// newOutbox returns outbox saved in given file.
+func newOutbox(path string) *outbox {
+	return &outbox{
+		Path:    path,
+		Entries: []outboxEntry{},
+	}
+}
+
+// load reads outbox contents from disk, missing file means empty outbox.
+func (o *outbox) load() error {
+	data, err := ioutil.ReadFile(o.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, o)
+}
+
+// save writes outbox contents to disk, replacing the file atomically.
+func (o *outbox) save() error {
+	if err := os.MkdirAll(filepath.Dir(o.Path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(o, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := o.Path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, o.Path)
+}
+
+// Add queues write of given type for later replay. Attempted marks write whose request
+// may have reached the store, so replay checks if it needs to be sent again.
+// Updated note has to keep modification date and version it was fetched with.
+func (o *outbox) Add(op string, n *Note, permanently, attempted bool) error {
+	if err := o.load(); err != nil {
+		return err
+	}
+	id, err := GenerateNoteKey()
+	if err != nil {
+		return err
+	}
+	entry := outboxEntry{
+		ID:          id,
+		Op:          op,
+		Note:        *n,
+		Permanently: permanently,
+		Queued:      SimpleNoteTimestamp(time.Now()),
+		Attempted:   attempted,
+	}
+	if op == outboxUpdate {
+		entry.BaseDate, entry.BaseVersion = n.ModifyDate, n.Version
+	}
+	o.Entries = append(o.Entries, entry)
+	return o.save()
+}
+
+// Len returns number of queued writes.
+func (o *outbox) Len() (int, error) {
+	if err := o.load(); err != nil {
+		return 0, err
+	}
+	return len(o.Entries), nil
+}
+
+// Replay sends queued writes to the store in order they were made.
+// Entries are removed one by one as they succeed, so replay can be safely
+// resumed after failure. Done is called with every entry once it's removed,
+// its note being the one saved in the store. Returns number of entries sent
+// and keys of notes which were changed elsewhere in a way conflicting with queued updates.
+func (o *outbox) Replay(store NoteStore, done func(entry *outboxEntry) error) (sent int, conflicts []string, err error) {
+	if err = o.load(); err != nil {
+		return
+	}
+	for len(o.Entries) > 0 {
+		entry := o.Entries[0]
+		clean := true
+		if clean, err = o.apply(store, &entry); err != nil {
+			return
+		}
+		if !clean {
+			conflicts = append(conflicts, entry.Note.Key)
+		}
+		sent++
+		o.Entries = o.Entries[1:]
+		if err = o.save(); err != nil {
+			return
+		}
+		if err = done(&entry); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// apply sends single entry to the store, replacing its note with the one saved there.
+// Reports whether queued update merged cleanly with changes made to the note
+// elsewhere, it's always true for other writes.
+func (o *outbox) apply(store NoteStore, entry *outboxEntry) (bool, error) {
+	switch entry.Op {
+	case outboxCreate:
+		return true, o.applyCreate(store, entry)
+	case outboxUpdate:
+		return applyUpdate(store, entry)
+	case outboxDelete:
+		// Notes already deleted by earlier replay which did not finish are gone.
+		if err := store.Trash(entry.Note.Key); err != nil && !errors.Is(err, simplenote.ErrNotFound) {
+			return true, err
+		}
+		if entry.Permanently {
+			if err := store.Purge(entry.Note.Key); err != nil && !errors.Is(err, simplenote.ErrNotFound) {
+				return true, err
+			}
+		}
+		return true, nil
+	}
+	return true, errors.New(fmt.Sprintf("Unknown outbox operation: %s", entry.Op))
+}
+
+// applyCreate sends queued note, unless earlier attempt already created it.
+func (o *outbox) applyCreate(store NoteStore, entry *outboxEntry) (err error) {
+	var created *Note
+	if entry.Attempted {
+		// Previous replay might have created the note without us knowing.
+		if created, err = findCreated(store, &entry.Note); err != nil {
+			return err
+		}
+	}
+	if created == nil {
+		entry.Attempted = true
+		if err = o.save(); err != nil {
+			return err
+		}
+		if created, err = store.Create(&entry.Note); err != nil {
+			return err
+		}
+	}
+	// Created note is returned without its content.
+	created.Content = entry.Note.Content
+	entry.Note = *created
+	return nil
+}
+
+// applyUpdate sends queued update, merging it with changes made to the note elsewhere
+// since it was queued. Reports whether the changes merged cleanly, if not conflicting
+// parts are saved between conflict markers, to be resolved by the user.
+func applyUpdate(store NoteStore, entry *outboxEntry) (bool, error) {
+	n := entry.Note
+	if entry.BaseDate == "" {
+		// Queued without its base, nothing to compare with.
+		return true, store.Update(&n)
+	}
+	remote, err := store.Fetch(n.Key)
+	if errors.Is(err, simplenote.ErrNotFound) {
+		// Note was purged elsewhere, update brings it back.
+		return true, store.Update(&n)
+	} else if err != nil {
+		return true, err
+	}
+	if remote.ModifyDate == entry.BaseDate {
+		return true, store.Update(&n)
+	}
+	base, err := store.FetchVersion(n.Key, entry.BaseVersion)
+	if errors.Is(err, simplenote.ErrNotFound) {
+		// Base version is no longer kept, both texts are shown as conflicting.
+		base = &Note{Deleted: n.Deleted, Tags: n.Tags, SystemTags: n.SystemTags}
+	} else if err != nil {
+		return true, err
+	}
+	merged, clean := MergeText(base.Content, n.Content, remote.Content)
+	n.Content = merged
+	if n.Deleted == base.Deleted {
+		n.Deleted = remote.Deleted
+	}
+	if equalLines(n.Tags, base.Tags) {
+		n.Tags = remote.Tags
+	}
+	if equalLines(n.SystemTags, base.SystemTags) {
+		n.SystemTags = remote.SystemTags
+	}
+	n.ModifyDate, n.Version = remote.ModifyDate, remote.Version
+	entry.Note = n
+	return clean, store.Update(&n)
+}
+
+// findCreated returns index entry of the note with the same creation date as queued one,
+// or nil if there is none. Creation date is set when note is queued so it identifies the note.
+func findCreated(store NoteStore, n *Note) (*Note, error) {
+	mark := ""
+	for {
+		l, err := store.Index(mark, defaultNoteAmount, IndexOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range l.Data {
+			if i.CreateDate == n.CreateDate {
+				return &i, nil
+			}
+		}
+		if l.Mark == "" {
+			return nil, nil
+		}
+		mark = l.Mark
+	}
+}
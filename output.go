@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+	outputYAML   = "yaml"
+	outputCSV    = "csv"
+	outputPlain  = "plain"
+)
+
+var (
+	// Output formats available with --output flag, empty one is the default coloured layout.
+	OutputFormats = []string{outputJSON, outputNDJSON, outputYAML, outputCSV, outputPlain}
+)
+
+// noteEncoder writes notes in one of the structured output formats.
+type noteEncoder interface {
+	// EncodeNotes writes list of notes.
+	EncodeNotes(w io.Writer, notes Notes) error
+	// EncodeNote writes single note.
+	EncodeNote(w io.Writer, n *Note) error
+}
+
+// newNoteEncoder returns encoder for given output format.
+func newNoteEncoder(format string) (noteEncoder, error) {
+	switch format {
+	case outputJSON:
+		return jsonEncoder{}, nil
+	case outputNDJSON:
+		return ndjsonEncoder{}, nil
+	case outputYAML:
+		return yamlEncoder{}, nil
+	case outputCSV:
+		return csvEncoder{}, nil
+	case outputPlain:
+		return plainEncoder{}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unknown output format: %s, available formats are: %s", format, strings.Join(OutputFormats, ", ")))
+}
+
+// streamed checks if encoder writes notes one by one, so list does not have to be held until it's complete.
+func streamed(enc noteEncoder) bool {
+	switch enc.(type) {
+	case ndjsonEncoder, plainEncoder:
+		return true
+	}
+	return false
+}
+
+// noteField is single field of the note written by YAML and CSV encoders.
+type noteField struct {
+	Name  string
+	Value interface{}
+}
+
+// noteFields returns fields of the note in order they are written, the same ones JSON output holds.
+func noteFields(n *Note) []noteField {
+	return []noteField{
+		{"key", n.Key},
+		{"createdate", n.CreateDate},
+		{"modifydate", n.ModifyDate},
+		{"tags", nonNilStrings(n.Tags)},
+		{"systemtags", nonNilStrings(n.SystemTags)},
+		{"deleted", n.Deleted},
+		{"version", n.Version},
+		{"minversion", n.MinVersion},
+		{"syncnum", n.SyncNum},
+		{"sharekey", n.ShareKey},
+		{"publishkey", n.PublishKey},
+		{"content", n.Content},
+	}
+}
+
+type jsonEncoder struct{}
+
+func (e jsonEncoder) EncodeNotes(w io.Writer, notes Notes) error {
+	return e.encode(w, nonNilNotes(notes))
+}
+
+func (e jsonEncoder) EncodeNote(w io.Writer, n *Note) error {
+	return e.encode(w, n)
+}
+
+func (jsonEncoder) encode(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// ndjsonEncoder writes every note as JSON object in separate line.
+type ndjsonEncoder struct{}
+
+func (ndjsonEncoder) EncodeNotes(w io.Writer, notes Notes) error {
+	enc := json.NewEncoder(w)
+	for i := range notes {
+		if err := enc.Encode(&notes[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ndjsonEncoder) EncodeNote(w io.Writer, n *Note) error {
+	return json.NewEncoder(w).Encode(n)
+}
+
+// yamlEncoder writes notes as YAML, strings are written as double-quoted
+// JSON strings and lists as JSON arrays, which are both valid YAML.
+type yamlEncoder struct{}
+
+func (e yamlEncoder) EncodeNotes(w io.Writer, notes Notes) error {
+	if len(notes) == 0 {
+		_, err := fmt.Fprintln(w, "[]")
+		return err
+	}
+	for i := range notes {
+		if err := e.encode(w, &notes[i], "- ", "  "); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e yamlEncoder) EncodeNote(w io.Writer, n *Note) error {
+	return e.encode(w, n, "", "")
+}
+
+func (yamlEncoder) encode(w io.Writer, n *Note, first, indent string) error {
+	for i, f := range noteFields(n) {
+		val, err := json.Marshal(f.Value)
+		if err != nil {
+			return err
+		}
+		prefix := indent
+		if i == 0 {
+			prefix = first
+		}
+		if _, err = fmt.Fprintf(w, "%s%s: %s\n", prefix, f.Name, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvEncoder writes notes as CSV with header row, tags are separated with commas.
+type csvEncoder struct{}
+
+func (csvEncoder) EncodeNotes(w io.Writer, notes Notes) error {
+	cw := csv.NewWriter(w)
+	header := []string{}
+	for _, f := range noteFields(&Note{}) {
+		header = append(header, f.Name)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, n := range notes {
+		if err := cw.Write(csvRecord(&n)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (e csvEncoder) EncodeNote(w io.Writer, n *Note) error {
+	return e.EncodeNotes(w, Notes{*n})
+}
+
+func csvRecord(n *Note) []string {
+	record := []string{}
+	for _, f := range noteFields(n) {
+		switch val := f.Value.(type) {
+		case []string:
+			record = append(record, strings.Join(val, ","))
+		case int:
+			record = append(record, strconv.Itoa(val))
+		default:
+			record = append(record, fmt.Sprint(val))
+		}
+	}
+	return record
+}
+
+// plainEncoder writes key of every note in separate line followed by its content,
+// without colours or decorations. Notes are separated with blank line.
+type plainEncoder struct{}
+
+func (e plainEncoder) EncodeNotes(w io.Writer, notes Notes) error {
+	for i := range notes {
+		if err := e.EncodeNote(w, &notes[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (plainEncoder) EncodeNote(w io.Writer, n *Note) error {
+	_, err := fmt.Fprintf(w, "%s\n%s\n\n", n.Key, strings.TrimRight(n.Content, "\n"))
+	return err
+}
+
+func nonNilNotes(n Notes) Notes {
+	if n == nil {
+		return Notes{}
+	}
+	return n
+}
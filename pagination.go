@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IndexOptions narrow down notes returned by note store index.
+type IndexOptions struct {
+	Content bool    // Whether note contents should be included in the index
+	Since   float64 // Return only notes modified after this timestamp, zero for all notes
+}
+
+// noteIterator walks the note index page by page. Next page is requested only when
+// previous one was used up, so callers can stop without loading the whole account.
+type noteIterator struct {
+	store  NoteStore
+	opts   IndexOptions
+	filter func(n *Note) bool
+	mark   string
+	seen   Notes // Entries read so far, including ones rejected by the filter
+	done   bool
+
+	withContent map[string]bool // Keys of entries read so far which had their content included
+}
+
+// newNoteIterator returns iterator over index entries of the store accepted by filter.
+func newNoteIterator(store NoteStore, opts IndexOptions, filter func(n *Note) bool) *noteIterator {
+	return &noteIterator{store: store, opts: opts, filter: filter, withContent: make(map[string]bool)}
+}
+
+// Next returns next page of the index, or nil once all the pages were read.
+// Page may be empty if none of its notes was accepted by the filter.
+func (it *noteIterator) Next() (Notes, error) {
+	if it.done {
+		return nil, nil
+	}
+	l, err := it.store.Index(it.mark, defaultNoteAmount, it.opts)
+	if err != nil {
+		return nil, err
+	}
+	if l.Mark == "" || l.Mark == it.mark {
+		it.done = true
+	}
+	it.mark = l.Mark
+	it.seen = append(it.seen, l.Data...)
+	for k := range l.WithContent {
+		it.withContent[k] = true
+	}
+	page := Notes{}
+	for _, n := range l.Data {
+		if it.filter == nil || it.filter(&n) {
+			page = append(page, n)
+		}
+	}
+	return page, nil
+}
+
+// notePages returns iterator over index entries matching user filters. Note contents
+// are included in the pages only when the cache can't serve them, otherwise
+// just changed notes are fetched, which is much less to download.
+func (s *simpleNoteClient) notePages() *noteIterator {
+	since, _ := strconv.ParseFloat(s.Params.Flags["since"], 64)
+	pages := newNoteIterator(s.Store, IndexOptions{Content: s.Cache.Cold(), Since: since}, s.matchesFilters)
+	// Entries with content are served by fetchNotes as they are.
+	s.withContent = pages.withContent
+	return pages
+}
+
+// wholeIndex checks if index of all the notes is requested, so notes
+// missing from it can be removed from the cache and search index.
+func (s *simpleNoteClient) wholeIndex() bool {
+	return s.Params.Flags["since"] == ""
+}
+
+// prune removes notes missing from the index from the cache and search index, once all
+// the pages were read. Entries rejected by user filters are kept, e.g. notes in trash.
+func (s *simpleNoteClient) prune(pages *noteIterator) error {
+	if !pages.done || !s.wholeIndex() {
+		return nil
+	}
+	if err := s.Cache.Prune(pages.seen); err != nil {
+		return err
+	}
+	return s.Index.Prune(pages.seen)
+}
+
+// ParseSince converts --since flag value to SimpleNote timestamp. Accepted values are
+// dates such as 2022-10-01 or "2022-10-01 15:04", and ages such as 7d, 36h or 30m,
+// m being minutes as in Go durations, there is no unit for months.
+func ParseSince(val string) (string, error) {
+	val = strings.TrimSpace(val)
+	var since time.Time
+	if strings.HasSuffix(val, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(val, "d"))
+		if err == nil && days >= 0 {
+			since = time.Now().AddDate(0, 0, -days)
+		}
+	} else if age, err := time.ParseDuration(val); err == nil && age >= 0 {
+		since = time.Now().Add(-age)
+	} else {
+		for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05", time.RFC3339} {
+			if t, err := time.ParseInLocation(layout, val, time.Local); err == nil {
+				since = t
+				break
+			}
+		}
+	}
+	if since.IsZero() {
+		return "", errors.New(fmt.Sprintf("Invalid --since value: %s, use date such as 2022-10-01 or age such as 7d, 36h or 30m", val))
+	}
+	return SimpleNoteTimestamp(since), nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	fuzzyMatchScore      = 1
+	fuzzyConsecutive     = 5 // Bonus for matching character right after previous match
+	fuzzyWordStart       = 3 // Bonus for matching first character of a word
+	pickerFieldSeparator = "\t"
+)
+
+// fuzzyMatch represents note matching query typed in picker.
+type fuzzyMatch struct {
+	Note  *Note
+	Text  string
+	Score int
+}
+
+// PickNote lets user choose the note when key was not passed, using external
+// picker command if configured or embedded fuzzy finder otherwise.
+// Returns empty key if user cancelled the choice.
+func (s *simpleNoteClient) pickNote() (string, error) {
+	notes, err := s.getNotes()
+	if err != nil {
+		return "", err
+	}
+	if len(notes) == 0 {
+		return "", errors.New("No notes to choose from.")
+	}
+	sort.Sort(sort.Reverse(notes))
+	if s.Cfg.Picker != "" {
+		return runExternalPicker(s.Cfg.Picker, notes)
+	}
+	term, err := openTerminal()
+	if err != nil {
+		return "", errors.New("Missing note key parameter.")
+	}
+	p := &fuzzyPicker{term: term, notes: notes}
+	fmt.Fprint(os.Stderr, ansiAltScreen)
+	defer func() {
+		fmt.Fprint(os.Stderr, ansiMainScreen)
+		term.Close()
+	}()
+	return p.run()
+}
+
+// runExternalPicker passes notes to external command, one per line, and returns key
+// from the line it printed. Line starts with note key followed by its title and tags.
+func runExternalPicker(command string, notes Notes) (string, error) {
+	input := &bytes.Buffer{}
+	for _, n := range notes {
+		fmt.Fprintln(input, strings.Join([]string{n.Key, noteHeader(&n), ParseTags(n.Tags)}, pickerFieldSeparator))
+	}
+	output := &bytes.Buffer{}
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = input
+	cmd.Stdout = output
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// Pickers exit with error when nothing was chosen.
+			return "", nil
+		}
+		return "", err
+	}
+	fields := strings.Fields(output.String())
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], nil
+}
+
+// fuzzyPicker is embedded finder filtering notes by their titles and tags as user types.
+type fuzzyPicker struct {
+	term     *terminal
+	notes    Notes
+	query    string
+	matches  []fuzzyMatch
+	selected int
+}
+
+func (p *fuzzyPicker) run() (string, error) {
+	p.filter()
+	for {
+		if err := p.draw(); err != nil {
+			return "", err
+		}
+		key, err := p.term.ReadKey()
+		if err != nil {
+			return "", err
+		}
+		switch key {
+		case keyEnter:
+			if len(p.matches) == 0 {
+				continue
+			}
+			return p.matches[p.selected].Note.Key, nil
+		case keyEscape, keyCtrlC:
+			return "", nil
+		case keyUp, "\x10": // Ctrl-P
+			if p.selected > 0 {
+				p.selected--
+			}
+		case keyDown, "\x0e": // Ctrl-N
+			if p.selected < len(p.matches)-1 {
+				p.selected++
+			}
+		case keyBackspace:
+			if r := []rune(p.query); len(r) > 0 {
+				p.query = string(r[:len(r)-1])
+				p.filter()
+			}
+		default:
+			if !strings.HasPrefix(key, keyEscape) && key >= " " {
+				p.query += key
+				p.filter()
+			}
+		}
+	}
+}
+
+// filter ranks notes against current query.
+func (p *fuzzyPicker) filter() {
+	p.matches = []fuzzyMatch{}
+	for i := range p.notes {
+		n := &p.notes[i]
+		text := noteHeader(n)
+		if len(n.Tags) > 0 {
+			text += " " + ParseTags(n.Tags)
+		}
+		if score, ok := FuzzyScore(p.query, text); ok {
+			p.matches = append(p.matches, fuzzyMatch{Note: n, Text: text, Score: score})
+		}
+	}
+	sort.SliceStable(p.matches, func(i, j int) bool {
+		return p.matches[i].Score > p.matches[j].Score
+	})
+	p.selected = 0
+}
+
+func (p *fuzzyPicker) draw() error {
+	cols, rows, err := p.term.Size()
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString(ansiClear)
+	writeLine(buf, fmt.Sprintf("%d/%d > %s_", len(p.matches), len(p.notes), p.query), cols)
+	for i, m := range p.matches {
+		if i >= rows-1 {
+			break
+		}
+		line := fitWidth(m.Text, cols)
+		if i == p.selected {
+			line = ansiReverse + line + ansiReset
+		}
+		buf.WriteString(line + "\n")
+	}
+	// Picker UI goes to stderr, so stdout can still be redirected.
+	_, err = os.Stderr.Write(buf.Bytes())
+	return err
+}
+
+// FuzzyScore checks if all characters of the pattern appear in the text in order,
+// returning score which is higher for consecutive matches and matches at word starts.
+func FuzzyScore(pattern, text string) (int, bool) {
+	p := []rune(strings.ToLower(strings.Join(strings.Fields(pattern), "")))
+	t := []rune(strings.ToLower(text))
+	score, pi := 0, 0
+	prev := -2
+	for ti := 0; ti < len(t) && pi < len(p); ti++ {
+		if t[ti] != p[pi] {
+			continue
+		}
+		score += fuzzyMatchScore
+		if prev == ti-1 {
+			score += fuzzyConsecutive
+		}
+		if ti == 0 || !(unicode.IsLetter(t[ti-1]) || unicode.IsDigit(t[ti-1])) {
+			score += fuzzyWordStart
+		}
+		prev = ti
+		pi++
+	}
+	return score, pi == len(p)
+}
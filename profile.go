@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// UseProfile switches to profile with given name. When name is empty profile set
+// in environment is used, falling back to default one from configuration file.
+func (c *mainConfig) UseProfile(name string) error {
+	if err := c.selectProfile(name); err != nil {
+		return err
+	}
+	return c.migrate()
+}
+
+// selectProfile switches to the profile without touching its settings.
+func (c *mainConfig) selectProfile(name string) error {
+	if name == "" {
+		name = os.Getenv(profileEnv)
+	}
+	if name == "" {
+		name = c.File.DefaultProfile
+	}
+	if name == "" || name == defaultProfile {
+		c.UserCfg = c.File
+	} else {
+		p, ok := c.File.Profiles[name]
+		if !ok {
+			return errors.New(fmt.Sprintf("Unknown profile: %s", name))
+		}
+		c.UserCfg = p
+	}
+	return nil
+}
+
+// ListProfiles prints all the profiles, marking default one and one in use.
+func (c *mainConfig) ListProfiles() {
+	current := c.UserCfg.Profile
+	if current == "" {
+		current = defaultProfile
+	}
+	def := c.File.DefaultProfile
+	if def == "" {
+		def = defaultProfile
+	}
+	for _, name := range c.profileNames() {
+		p := c.File
+		if name != defaultProfile {
+			p = c.File.Profiles[name]
+		}
+		marker := " "
+		if name == current {
+			marker = "*"
+		}
+		line := fmt.Sprintf("%s %s (%s)", marker, name, profileAccount(p))
+		if name == def {
+			line += " [default]"
+		}
+		fmt.Println(line)
+	}
+}
+
+// AddProfile asks user for settings of new profile and saves it in configuration file.
+func (c *mainConfig) AddProfile(name string) (err error) {
+	if name == "" {
+		return errors.New("Missing profile name.")
+	}
+	if !validProfileName(name) {
+		return errors.New(fmt.Sprintf("Invalid profile name: %s", name))
+	}
+	if _, ok := c.File.Profiles[name]; ok {
+		return errors.New(fmt.Sprintf("Profile %s already exists.", name))
+	}
+	fmt.Printf("Creating GoNote profile %s\n", name)
+	c.UserCfg = newUserConfig(name)
+	if err = c.prompt(); err != nil {
+		return
+	}
+	if c.File.Profiles == nil {
+		c.File.Profiles = make(map[string]*UserConfigFile)
+	}
+	c.File.Profiles[name] = c.UserCfg
+	if err = c.save(); err != nil {
+		return
+	}
+	fmt.Printf("Profile %s added, use it with --profile %s or %s=%s.\n", name, name, profileEnv, name)
+	return
+}
+
+// RemoveProfile deletes profile from configuration file together with its local data.
+func (c *mainConfig) RemoveProfile(name string) (err error) {
+	if name == defaultProfile {
+		return errors.New("Default profile can't be removed.")
+	}
+	p, ok := c.File.Profiles[name]
+	if !ok {
+		return errors.New(fmt.Sprintf("Unknown profile: %s", name))
+	}
+	fmt.Printf("Remove profile %s (%s) together with its cached notes, search index and credentials? [y/N]:\n", name, profileAccount(p))
+	answer, err := c.input().ReadString('\n')
+	if err != nil || strings.ToLower(strings.TrimSpace(answer)) != "y" {
+		return nil
+	}
+	delete(c.File.Profiles, name)
+	if c.File.DefaultProfile == name {
+		c.File.DefaultProfile = ""
+	}
+	if err = c.save(); err != nil {
+		return
+	}
+	if validProfileName(name) {
+		if err = removeProfileData(p); err != nil {
+			return
+		}
+	}
+	fmt.Printf("Profile %s removed.\n", name)
+	if p.Backend == localBackend {
+		fmt.Printf("Notes kept in %s were left in place.\n", p.NotesDir)
+	}
+	return
+}
+
+// removeProfileData deletes files gonote keeps for the profile. Notes directory of local
+// backend is never removed, even when it lives in profile data directory.
+func removeProfileData(p *UserConfigFile) error {
+	for _, f := range []string{defaultTokenPath, defaultTokenPath + ".lock", defaultOutboxPath, defaultIndexPath, defaultAliasesPath, defaultCredentialsFile} {
+		if err := os.Remove(ExpandPath(p.dataPath(f))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	cacheDir := ExpandPath(p.dataPath(defaultCacheDir))
+	notesDir := path.Clean(ExpandPath(p.NotesDir))
+	if path.Clean(ExpandPath(p.CacheDir)) == cacheDir && notesDir != cacheDir && !strings.HasPrefix(notesDir, cacheDir+"/") {
+		if err := os.RemoveAll(cacheDir); err != nil {
+			return err
+		}
+	}
+	// Fails when anything else is left in the directory, e.g. notes.
+	os.Remove(ExpandPath(p.dataPath("")))
+	return nil
+}
+
+// SetDefaultProfile makes profile used when none is chosen.
+func (c *mainConfig) SetDefaultProfile(name string) error {
+	if _, ok := c.File.Profiles[name]; !ok && name != defaultProfile {
+		return errors.New(fmt.Sprintf("Unknown profile: %s", name))
+	}
+	c.File.DefaultProfile = name
+	if name == defaultProfile {
+		c.File.DefaultProfile = ""
+	}
+	if err := c.save(); err != nil {
+		return err
+	}
+	fmt.Printf("Profile %s is now used by default.\n", name)
+	return nil
+}
+
+// profileNames returns names of all the profiles, default one first.
+func (c *mainConfig) profileNames() []string {
+	names := []string{}
+	for name := range c.File.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{defaultProfile}, names...)
+}
+
+// validProfileName checks if profile name can be used as name of its data directory.
+func validProfileName(name string) bool {
+	return name != defaultProfile && name != "." && name != ".." && !strings.ContainsAny(name, "/\\ \t")
+}
+
+// profileAccount describes where notes of the profile are kept.
+func profileAccount(p *UserConfigFile) string {
+	if p.Backend == localBackend {
+		return p.NotesDir
+	}
+	return p.Email
+}
+
+// manageProfiles runs profile subcommand passed by the user.
+func manageProfiles(config MainConfig, params *CommandLineParams) error {
+	name := params.Flags["name"]
+	switch params.Flags["command"] {
+	case "", "list":
+		config.ListProfiles()
+		return nil
+	case "add":
+		return config.AddProfile(name)
+	case "remove":
+		return config.RemoveProfile(name)
+	case "default":
+		return config.SetDefaultProfile(name)
+	}
+	return errors.New(fmt.Sprintf("Unknown profile command: %s, available commands are: list, add, remove, default", params.Flags["command"]))
+}
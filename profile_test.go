@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestConfig returns configuration saved in temporary directory, answering prompts with given input.
+func newTestConfig(configPath, input string) *mainConfig {
+	cfg := newUserConfig("")
+	cfg.Email = fakeEmail
+	return &mainConfig{
+		Path:    configPath,
+		File:    cfg,
+		UserCfg: cfg,
+		Input:   bufio.NewReader(strings.NewReader(input)),
+	}
+}
+
+// testProfileName returns name of profile unique to the test. Profile data is kept
+// in home directory, so it's removed when the test finishes.
+func testProfileName(t *testing.T) string {
+	name := fmt.Sprintf("gonote-test-%d", time.Now().UnixNano())
+	t.Cleanup(func() { os.RemoveAll(ExpandPath(path.Join(profilesDir, name))) })
+	return name
+}
+
+func TestLoadMissingConfig(t *testing.T) {
+	c := newTestConfig(filepath.Join(t.TempDir(), "gonote.json"), "")
+	if err := c.LoadExisting(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(c.Path); !os.IsNotExist(err) {
+		t.Errorf("Expected configuration file not to be created, got %v", err)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	t.Setenv(profileEnv, "")
+	configPath := filepath.Join(t.TempDir(), "gonote.json")
+	name := testProfileName(t)
+	c := newTestConfig(configPath, "simplenote\nwork@example.com\nenv:GONOTE_TEST_PASSWORD\n")
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	out := capture(t, &os.Stdout, func() { err = c.AddProfile(name) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, out, "Profile "+name+" added")
+	if err = c.AddProfile(name); err == nil {
+		t.Error("Expected adding existing profile to fail")
+	}
+
+	load := func() *mainConfig {
+		c := newTestConfig(configPath, "")
+		if err := c.LoadExisting(); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	selected := func(c *mainConfig, flag string) string {
+		t.Helper()
+		if err := c.UseProfile(flag); err != nil {
+			t.Fatal(err)
+		}
+		return c.GetUserConfig().Email
+	}
+	c = load()
+	if p := c.File.Profiles[name]; p == nil || p.Credentials != "env:GONOTE_TEST_PASSWORD" {
+		t.Fatalf("Unexpected saved profile: %+v", p)
+	}
+	if email := selected(c, ""); email != fakeEmail {
+		t.Errorf("Expected default profile to be used, got %s", email)
+	}
+	parser := &commandLineParser{Params: &CommandLineParams{Flags: make(map[string]string)}}
+	if err = parser.parse([]string{"list", "--profile", name}); err != nil {
+		t.Fatal(err)
+	}
+	if email := selected(c, parser.Params.Flags["profile"]); email != "work@example.com" {
+		t.Errorf("Expected --profile to select the profile, got %s", email)
+	}
+	t.Setenv(profileEnv, name)
+	if email := selected(load(), ""); email != "work@example.com" {
+		t.Errorf("Expected %s to select the profile, got %s", profileEnv, email)
+	}
+	if email := selected(load(), defaultProfile); email != fakeEmail {
+		t.Errorf("Expected --profile to override %s, got %s", profileEnv, email)
+	}
+	t.Setenv(profileEnv, "")
+
+	capture(t, &os.Stdout, func() { err = load().SetDefaultProfile(name) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = load()
+	if email := selected(c, ""); email != "work@example.com" {
+		t.Errorf("Expected default profile to be used, got %s", email)
+	}
+	out = capture(t, &os.Stdout, c.ListProfiles)
+	assertContains(t, out, "  default ("+fakeEmail+")\n", "* "+name+" (work@example.com) [default]\n")
+	if err = c.UseProfile("missing"); err == nil || !strings.Contains(err.Error(), "Unknown profile") {
+		t.Errorf("Expected unknown profile to be rejected, got %v", err)
+	}
+}
+
+func TestProfilePaths(t *testing.T) {
+	name := testProfileName(t)
+	c := newTestConfig(filepath.Join(t.TempDir(), "gonote.json"), "")
+	c.File.Credentials = "env:GONOTE_TEST_PASSWORD"
+	p := newUserConfig(name)
+	p.Credentials = c.File.Credentials
+	c.File.Profiles = map[string]*UserConfigFile{name: p}
+	for _, profile := range []string{defaultProfile, name} {
+		if err := c.selectProfile(profile); err != nil {
+			t.Fatal(err)
+		}
+		dir := "~/.gonote"
+		if profile != defaultProfile {
+			dir = path.Join(profilesDir, name)
+		}
+		store, err := newNoteStore(context.Background(), c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := newSimpleNoteClient(store, c, &CommandLineParams{}).(*simpleNoteClient)
+		paths := map[string]string{
+			"token.json":   store.(*simpleNoteStore).Tokens.Path,
+			"index.json":   client.Index.Path,
+			"outbox.json":  client.Outbox.Path,
+			"aliases.json": client.Aliases.Path,
+			"cache":        client.Cache.store.Dir,
+		}
+		for file, got := range paths {
+			if expected := ExpandPath(path.Join(dir, file)); got != expected {
+				t.Errorf("Expected %s of profile %s in %s, got %s", file, profile, expected, got)
+			}
+		}
+	}
+}
+
+func TestRemoveProfile(t *testing.T) {
+	name := testProfileName(t)
+	configPath := filepath.Join(t.TempDir(), "gonote.json")
+	// Both answers are buffered at once, second prompt must see what's left by the first one.
+	c := newTestConfig(configPath, "n\ny\n")
+	p := newUserConfig(name)
+	c.File.Profiles = map[string]*UserConfigFile{name: p}
+	c.File.DefaultProfile = name
+	files := []string{ExpandPath(p.dataPath(defaultTokenPath)), filepath.Join(ExpandPath(p.CacheDir), "note.md")}
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(f, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var err error
+	capture(t, &os.Stdout, func() { err = c.RemoveProfile(name) })
+	if _, ok := c.File.Profiles[name]; err != nil || !ok {
+		t.Fatalf("Expected profile to be kept when removal was not confirmed, got %v", err)
+	}
+	out := capture(t, &os.Stdout, func() { err = c.RemoveProfile(name) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, out, "Profile "+name+" removed.")
+	saved := newTestConfig(configPath, "")
+	if err = saved.LoadExisting(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := saved.File.Profiles[name]; ok || saved.File.DefaultProfile != "" {
+		t.Errorf("Expected profile to be removed from configuration file, got %+v", saved.File)
+	}
+	for _, f := range files {
+		if _, err = os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed, got %v", f, err)
+		}
+	}
+	if err = c.RemoveProfile(defaultProfile); err == nil {
+		t.Error("Expected default profile removal to be rejected")
+	}
+}
@@ -0,0 +1,528 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	snippetContext    = 40 // Number of characters shown around the match in search results
+	headerMatchWeight = 2  // Matches in the first line of the note count more when ranking
+	queryDateFormat   = "2006-01-02"
+)
+
+// Query represents parsed search query which can be matched against notes.
+// Supported syntax:
+//
+//	word             notes containing any form of the word (case insensitive)
+//	"some phrase"    notes containing the phrase
+//	/regex/          notes matching regular expression
+//	tag:name         notes tagged with given tag
+//	after:date       notes modified after given date (YYYY-MM-DD)
+//	before:date      notes modified before given date (YYYY-MM-DD)
+//	a AND b, a b     notes matching both queries
+//	a OR b           notes matching any of the queries
+//	NOT a            notes not matching the query
+//	( ... )          grouping
+type Query interface {
+	// Match reports whether note matches the query, returning
+	// positions of all matched fragments of its content.
+	Match(n *Note) (bool, [][]int)
+	// Candidates returns keys of notes from the index which may match the query,
+	// nil means any note may match.
+	Candidates(idx *searchIndex) map[string]bool
+}
+
+// wordQuery matches words with the same stem.
+type wordQuery struct {
+	stem string
+	stop bool // Stop words are not indexed, any note may contain them
+}
+
+// phraseQuery matches phrase in note content.
+type phraseQuery struct {
+	re    *regexp.Regexp
+	stems []string
+}
+
+// regexQuery matches regular expression in note content.
+type regexQuery struct {
+	re *regexp.Regexp
+}
+
+// tagQuery matches notes with given tag.
+type tagQuery struct {
+	tag string
+}
+
+// dateQuery matches notes modified before or after given time.
+type dateQuery struct {
+	ts    int64
+	after bool
+}
+
+type andQuery struct {
+	queries []Query
+}
+
+type orQuery struct {
+	queries []Query
+}
+
+type notQuery struct {
+	query Query
+}
+
+func (q *wordQuery) Match(n *Note) (bool, [][]int) {
+	spans := [][]int{}
+	for _, t := range Tokenize(n.Content) {
+		if Stem(t.Text) == q.stem {
+			spans = append(spans, []int{t.Start, t.End})
+		}
+	}
+	return len(spans) > 0, spans
+}
+
+func (q *wordQuery) Candidates(idx *searchIndex) map[string]bool {
+	if q.stop {
+		return nil
+	}
+	return idx.Lookup(q.stem)
+}
+
+func (q *phraseQuery) Match(n *Note) (bool, [][]int) {
+	spans := q.re.FindAllStringIndex(n.Content, -1)
+	return len(spans) > 0, spans
+}
+
+func (q *phraseQuery) Candidates(idx *searchIndex) map[string]bool {
+	var keys map[string]bool
+	for _, stem := range q.stems {
+		keys = intersectKeys(keys, idx.Lookup(stem))
+	}
+	return keys
+}
+
+func (q *regexQuery) Match(n *Note) (bool, [][]int) {
+	spans := q.re.FindAllStringIndex(n.Content, -1)
+	return len(spans) > 0, spans
+}
+
+func (q *regexQuery) Candidates(idx *searchIndex) map[string]bool {
+	return nil
+}
+
+func (q *tagQuery) Match(n *Note) (bool, [][]int) {
+	return CheckIn(q.tag, n.Tags), nil
+}
+
+func (q *tagQuery) Candidates(idx *searchIndex) map[string]bool {
+	return idx.Filter(func(d *indexedNote) bool { return CheckIn(q.tag, d.Tags) })
+}
+
+func (q *dateQuery) Match(n *Note) (bool, [][]int) {
+	return q.matchDate(n.ModifyDate), nil
+}
+
+func (q *dateQuery) Candidates(idx *searchIndex) map[string]bool {
+	return idx.Filter(func(d *indexedNote) bool { return q.matchDate(d.ModifyDate) })
+}
+
+func (q *dateQuery) matchDate(d string) bool {
+	if q.after {
+		return GetSimpleNoteTimestamp(d) >= q.ts
+	}
+	return GetSimpleNoteTimestamp(d) < q.ts
+}
+
+func (q *andQuery) Match(n *Note) (bool, [][]int) {
+	all := [][]int{}
+	for _, sub := range q.queries {
+		ok, spans := sub.Match(n)
+		if !ok {
+			return false, nil
+		}
+		all = append(all, spans...)
+	}
+	return true, all
+}
+
+func (q *andQuery) Candidates(idx *searchIndex) map[string]bool {
+	var keys map[string]bool
+	for _, sub := range q.queries {
+		keys = intersectKeys(keys, sub.Candidates(idx))
+	}
+	return keys
+}
+
+func (q *orQuery) Match(n *Note) (bool, [][]int) {
+	matched := false
+	all := [][]int{}
+	for _, sub := range q.queries {
+		if ok, spans := sub.Match(n); ok {
+			matched = true
+			all = append(all, spans...)
+		}
+	}
+	return matched, all
+}
+
+func (q *orQuery) Candidates(idx *searchIndex) map[string]bool {
+	keys := make(map[string]bool)
+	for _, sub := range q.queries {
+		c := sub.Candidates(idx)
+		if c == nil {
+			return nil
+		}
+		for k := range c {
+			keys[k] = true
+		}
+	}
+	return keys
+}
+
+func (q *notQuery) Match(n *Note) (bool, [][]int) {
+	ok, _ := q.query.Match(n)
+	return !ok, nil
+}
+
+func (q *notQuery) Candidates(idx *searchIndex) map[string]bool {
+	return nil
+}
+
+// intersectKeys returns keys present in both sets, nil set meaning all keys.
+func intersectKeys(a, b map[string]bool) map[string]bool {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	keys := make(map[string]bool)
+	for k := range a {
+		if b[k] {
+			keys[k] = true
+		}
+	}
+	return keys
+}
+
+// SearchResult represents note matching search query.
+type SearchResult struct {
+	Note  Note
+	Score int
+	Spans [][]int
+}
+
+// ParseQuery parses search query entered by the user.
+func ParseQuery(query string) (Query, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("Empty search query.")
+	}
+	p := &queryParser{tokens: tokens}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, errors.New(fmt.Sprintf("Unexpected '%s' in search query.", p.tokens[p.pos].val))
+	}
+	return q, nil
+}
+
+// Search returns notes matching the query, most relevant first.
+func Search(q Query, notes Notes) []SearchResult {
+	results := []SearchResult{}
+	for _, n := range notes {
+		ok, spans := q.Match(&n)
+		if !ok {
+			continue
+		}
+		header := strings.IndexByte(n.Content, '\n')
+		if header == -1 {
+			header = len(n.Content)
+		}
+		score := 0
+		for _, sp := range spans {
+			if sp[0] < header {
+				score += headerMatchWeight
+			} else {
+				score++
+			}
+		}
+		sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+		results = append(results, SearchResult{Note: n, Score: score, Spans: spans})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return GetSimpleNoteTimestamp(results[i].Note.ModifyDate) > GetSimpleNoteTimestamp(results[j].Note.ModifyDate)
+	})
+	return results
+}
+
+// Snippet returns fragment of the note around the first match, with matches highlighted.
+func (r *SearchResult) Snippet() string {
+	content := r.Note.Content
+	if len(r.Spans) == 0 {
+		return noteHeader(&r.Note)
+	}
+	start := r.Spans[0][0] - snippetContext
+	if start < 0 {
+		start = 0
+	}
+	end := r.Spans[0][1] + snippetContext
+	if end > len(content) {
+		end = len(content)
+	}
+	// Don't cut multibyte characters in half.
+	for start > 0 && !isRuneStart(content[start]) {
+		start--
+	}
+	for end < len(content) && !isRuneStart(content[end]) {
+		end++
+	}
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("...")
+	}
+	pos := start
+	for _, sp := range r.Spans {
+		if sp[0] < pos || sp[1] > end {
+			continue
+		}
+		b.WriteString(content[pos:sp[0]])
+		b.WriteString(highlightColored(content[sp[0]:sp[1]]))
+		pos = sp[1]
+	}
+	b.WriteString(content[pos:end])
+	if end < len(content) {
+		b.WriteString("...")
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+const (
+	tokenWord = iota
+	tokenPhrase
+	tokenRegex
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type queryToken struct {
+	kind int
+	val  string
+}
+
+// tokenizeQuery splits query into words, phrases, regular expressions and operators.
+func tokenizeQuery(query string) ([]queryToken, error) {
+	tokens := []queryToken{}
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{tokenOpen, "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{tokenClose, ")"})
+			i++
+		case r == '"' || r == '/':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				if r == '/' && runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(runes) {
+				return nil, errors.New(fmt.Sprintf("Unterminated %c in search query.", r))
+			}
+			kind := tokenPhrase
+			if r == '/' {
+				kind = tokenRegex
+			}
+			tokens = append(tokens, queryToken{kind, string(runes[i+1 : end])})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '(' && runes[end] != ')' {
+				end++
+			}
+			word := string(runes[i:end])
+			switch word {
+			case "AND":
+				tokens = append(tokens, queryToken{tokenAnd, word})
+			case "OR":
+				tokens = append(tokens, queryToken{tokenOr, word})
+			case "NOT":
+				tokens = append(tokens, queryToken{tokenNot, word})
+			default:
+				tokens = append(tokens, queryToken{tokenWord, word})
+			}
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// queryParser is recursive descent parser building Query from tokens.
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() *queryToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *queryParser) parseOr() (Query, error) {
+	q, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	queries := []Query{q}
+	for t := p.peek(); t != nil && t.kind == tokenOr; t = p.peek() {
+		p.pos++
+		if q, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+	if len(queries) == 1 {
+		return queries[0], nil
+	}
+	return &orQuery{queries}, nil
+}
+
+func (p *queryParser) parseAnd() (Query, error) {
+	q, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	queries := []Query{q}
+	for t := p.peek(); t != nil && t.kind != tokenOr && t.kind != tokenClose; t = p.peek() {
+		if t.kind == tokenAnd {
+			p.pos++
+		}
+		if q, err = p.parseNot(); err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+	if len(queries) == 1 {
+		return queries[0], nil
+	}
+	return &andQuery{queries}, nil
+}
+
+func (p *queryParser) parseNot() (Query, error) {
+	t := p.peek()
+	if t != nil && t.kind == tokenNot {
+		p.pos++
+		q, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notQuery{q}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (Query, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, errors.New("Unexpected end of search query.")
+	}
+	p.pos++
+	switch t.kind {
+	case tokenOpen:
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.peek(); c == nil || c.kind != tokenClose {
+			return nil, errors.New("Missing ')' in search query.")
+		}
+		p.pos++
+		return q, nil
+	case tokenWord:
+		return parseWord(t.val)
+	case tokenPhrase:
+		return newPhraseQuery(t.val)
+	case tokenRegex:
+		re, err := regexp.Compile(t.val)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid regular expression in search query: %s", err))
+		}
+		return &regexQuery{re}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unexpected '%s' in search query.", t.val))
+}
+
+// parseWord returns query for single word, which may be one of field queries.
+func parseWord(word string) (Query, error) {
+	if parts := strings.SplitN(word, ":", 2); len(parts) == 2 && parts[1] != "" {
+		switch parts[0] {
+		case "tag":
+			return &tagQuery{strings.TrimPrefix(parts[1], tagPrefix)}, nil
+		case "after", "before":
+			t, err := time.ParseInLocation(queryDateFormat, parts[1], time.Local)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("Invalid date in search query: %s, expected YYYY-MM-DD.", parts[1]))
+			}
+			return &dateQuery{ts: t.Unix(), after: parts[0] == "after"}, nil
+		}
+	}
+	tokens := Tokenize(word)
+	if len(tokens) == 0 {
+		return &regexQuery{regexp.MustCompile(`(?i)` + regexp.QuoteMeta(word))}, nil
+	}
+	if len(tokens) > 1 {
+		// Words like "e-mail" are searched as phrases.
+		return newPhraseQuery(word)
+	}
+	return &wordQuery{Stem(tokens[0].Text), isStopWord(tokens[0].Text)}, nil
+}
+
+// newPhraseQuery returns query matching words of the phrase separated by any whitespace.
+func newPhraseQuery(phrase string) (Query, error) {
+	words := strings.Fields(phrase)
+	if len(words) == 0 {
+		return nil, errors.New("Empty phrase in search query.")
+	}
+	q := &phraseQuery{}
+	for i, w := range words {
+		words[i] = regexp.QuoteMeta(w)
+	}
+	for _, t := range Tokenize(phrase) {
+		if !isStopWord(t.Text) {
+			q.stems = append(q.stems, Stem(t.Text))
+		}
+	}
+	q.re = regexp.MustCompile(`(?i)` + strings.Join(words, `\s+`))
+	return q, nil
+}
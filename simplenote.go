@@ -1,74 +1,57 @@
 package main
 
 import (
-	"bytes"
-	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/exaroth/gonote/v2/simplenote"
 	"github.com/fatih/color"
 	"io"
-	"io/ioutil"
-	"log"
-	"net/http"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 const (
-	baseUrl                 = "https://simple-note.appspot.com/api2/"
-	authorizeUrl            = "https://simple-note.appspot.com/api/login"
-	dataEndpoint            = "data"
-	indexEndpoint           = "index"
-	defaultNoteAmount       = 100
-	defaultNoteFetchTimeout = 10 // Max time wait to retrieve all the notes, in secs.
-	noteHeaderLength        = 80 // Max number of characters to be used in note header
+	defaultNoteAmount   = 100
+	defaultFetchWorkers = 8        // Number of notes fetched at once
+	noteHeaderLength    = 80       // Max number of characters to be used in note header
+	queuedNoteLabel     = "queued" // Shown instead of the key of note created offline
 )
 
 var (
-	// Default headers sent with each request to SimpleNote servers.
-	simpleNoteHeaders = map[string]string{
-		"User-Agent":   fmt.Sprintf("GoNote/%s", Version),
-		"Accept":       "application/json",
-		"Content-Type": "application/json",
-	}
 	blueColored = color.New(color.FgBlue).SprintFunc()
 	redColored  = color.New(color.FgRed).SprintFunc()
 	cyanColored = color.New(color.FgCyan).SprintFunc()
+
+	highlightColored = color.New(color.FgYellow, color.Bold).SprintFunc()
 )
 
 // Note represents note object returned by SimpleNote API.
-type Note struct {
-	Content    string   `json:"content"`
-	Tags       []string `json:"tags"`
-	SystemTags []string `json:"systemtags"`
-	Deleted    int      `json:"deleted,omitempty"`
-	Key        string   `json:"key,omitempty"`
-	ShareKey   string   `json:"sharekey,omitempty"`
-	PublishKey string   `json:"publishkey,omitempty"`
-	ModifyDate string   `json:"modifydate"`
-	CreateDate string   `json:"createdate"`
-}
-
-type Notes []Note // Need it for sorting
+type Note = simplenote.Note
 
 // NoteList represents list object returned by SimpleNote when calling note list endpoint.
-type NoteList struct {
-	Count int    `json:"count"`
-	Data  []Note `json:"data"`
-	Mark  string `json:"mark"`
-}
+type NoteList = simplenote.NoteList
+
+type Notes []Note // Need it for sorting
 
 var (
-	noteListBody = `Showing %s notes for %s:
+	noteListHeader = `Notes for %s:
 ==================================
-%s
 `
+	noteListFooter = "Showing %s notes.\n"
 	noteListRecord = `%s
 %s %s
 %s
+----------------------------------`
+	noteSearchBody = `Found %s notes matching %s:
+==================================
+%s
+`
+	noteHistoryRecord = `%s %s
+%s
 ----------------------------------`
 )
 
@@ -76,37 +59,82 @@ var (
 type SimpleNoteClient interface {
 	Authorize() error
 	Handle() error
-	makeRequest(string, string, io.Reader, map[string]string) ([]byte, error, int)
-	parseAddr(*http.Request, map[string]string)
-	getAllNotes(Notes, string) (Notes, error)
-	fetchNote(*Note) Note
+	getAllNotes() (Notes, error)
+	fetchNote(*Note) (Note, error)
 	listNotes() error
+	searchNotes() error
+	browseNotes() error
 	createNote() (*Note, error)
 	deleteNote() error
 	updateNote(n *Note) error
 	editNote() error
-	showNotes(notes Notes)
-	showNote(note *Note)
+	pickNote() (string, error)
+	resolveKey(ref string) (string, error)
+	aliasNote() error
+	syncNotes() error
+	showHistory() error
+	showVersion() error
+	restoreNote() error
+	newNoteListWriter() (*noteListWriter, error)
+	showNote(note *Note) error
 }
 
 // simpleNoteClient represents struct containing all data needed for
-// calling SimpleNote.
+// handling user actions against the note store.
 type simpleNoteClient struct {
-	Client *http.Client
-	Token  string
-	Cfg    *UserConfigFile
-	Params *CommandLineParams
+	Store   NoteStore
+	Cache   *noteCache
+	Outbox  *outbox
+	Index   *searchIndex
+	Aliases *aliasTable
+	Cfg     *UserConfigFile
+	Params  *CommandLineParams
+	Stdout  io.Writer // Where confirmations of changes are written, standard output if nil
+	Stderr  io.Writer // Where warnings about changes are written, standard error if nil
+
+	withContent map[string]bool // Keys of index entries listed with their content by the last iterator
+
+	// Notices below are shown once per run, as every fetched note would report the same.
+	offlineNotice sync.Once
+	cacheNotice   sync.Once
+}
+
+// stdout returns writer for confirmations of changes made to notes.
+func (s *simpleNoteClient) stdout() io.Writer {
+	if s.Stdout == nil {
+		return os.Stdout
+	}
+	return s.Stdout
 }
 
-// newSimpleNoteClient returns client used for communicating with SimpleNote.
-func newSimpleNoteClient(httpClient *http.Client, config MainConfig, params *CommandLineParams) SimpleNoteClient {
-	if httpClient == nil {
-		httpClient = http.DefaultClient
+// stderr returns writer for warnings about changes made to notes.
+func (s *simpleNoteClient) stderr() io.Writer {
+	if s.Stderr == nil {
+		return os.Stderr
 	}
+	return s.Stderr
+}
+
+// cacheNote saves note fetched from the store in cache, warning when it can't be written.
+// Cache is only a copy, so failing to keep it doesn't stop the note from being shown.
+func (s *simpleNoteClient) cacheNote(n *Note) {
+	if err := s.Cache.Put(n); err != nil {
+		s.cacheNotice.Do(func() {
+			fmt.Fprintf(s.stderr(), "Could not cache notes: %s\n", err)
+		})
+	}
+}
+
+// newSimpleNoteClient returns client used for managing notes kept in given store.
+func newSimpleNoteClient(store NoteStore, config MainConfig, params *CommandLineParams) SimpleNoteClient {
 	return &simpleNoteClient{
-		Client: httpClient,
-		Cfg:    config.GetUserConfig(),
-		Params: params,
+		Store:   store,
+		Cache:   newNoteCache(config.GetUserConfig()),
+		Outbox:  newOutbox(ExpandPath(config.GetUserConfig().dataPath(defaultOutboxPath))),
+		Index:   newSearchIndex(ExpandPath(config.GetUserConfig().dataPath(defaultIndexPath))),
+		Aliases: newAliasTable(ExpandPath(config.GetUserConfig().dataPath(defaultAliasesPath))),
+		Cfg:     config.GetUserConfig(),
+		Params:  params,
 	}
 }
 
@@ -115,30 +143,60 @@ func (s *simpleNoteClient) Handle() error {
 	// Check for list or other parameters and call action
 	// If not create new note
 	if s.Params.Action != "" {
+		if cmd, ok := lookupCommand(s.Params.Action); ok && cmd.NeedsKey {
+			if s.Params.Key == "" {
+				key, err := s.pickNote()
+				if err != nil || key == "" {
+					return err
+				}
+				s.Params.Key = key
+			} else {
+				key, err := s.resolveKey(s.Params.Key)
+				if err != nil {
+					return err
+				}
+				s.Params.Key = key
+			}
+		}
 		switch s.Params.Action {
-		case "version":
-			fmt.Println(ListVersion())
 		case "list":
 			return s.listNotes()
+		case "search":
+			return s.searchNotes()
+		case "tui":
+			return s.browseNotes()
 		case "edit":
 			return s.editNote()
 		case "delete":
 			return s.deleteNote()
+		case "sync":
+			return s.syncNotes()
+		case "history":
+			return s.showHistory()
+		case "show":
+			return s.showVersion()
+		case "restore":
+			return s.restoreNote()
+		case "alias":
+			return s.aliasNote()
+		case "logout":
+			return s.logout()
 		case "get":
 			n := &Note{
 				Key: s.Params.Key,
 			}
-			retrieved := s.fetchNote(n)
-			s.showNote(&retrieved)
-			return nil
+			retrieved, err := s.fetchNote(n)
+			if err != nil {
+				return err
+			}
+			return s.showNote(&retrieved)
 		}
 	} else {
 		newNote, err := s.createNote()
 		if err != nil {
 			return err
 		}
-		s.showNote(newNote)
-		return nil
+		return s.showNote(newNote)
 	}
 	return nil
 }
@@ -148,150 +206,616 @@ func (s *simpleNoteClient) updateNote(n *Note) (err error) {
 	if s.Params.Key == "" { // Should never happen
 		return errors.New("Missing key parameter in request.")
 	}
-	data, err := json.Marshal(n)
-	if err != nil {
+	if err = s.Store.Update(n); err != nil {
+		if IsNetworkError(err) {
+			return s.queueWrite(outboxUpdate, n, false)
+		}
 		return
 	}
-	_, err, code := s.makeRequest(fmt.Sprintf("%s%s/%s", baseUrl, dataEndpoint, n.Key), http.MethodPost, bytes.NewReader(data), nil)
-	if code != http.StatusOK {
-		return errors.New(fmt.Sprintf("Error when updating note, code was: %d", code))
+	if err = s.Cache.Put(n); err != nil {
+		return
 	}
-	fmt.Println("Note updated.")
-	return
+	if err = s.Index.Add(n); err != nil {
+		return
+	}
+	fmt.Fprintln(s.stdout(), "Note updated.")
+	return s.Index.Save()
+}
+
+// queueWrite saves write which failed due to network error in the outbox, to be sent with sync action.
+// Network errors include timeouts, so the request may have been handled by the server already.
+func (s *simpleNoteClient) queueWrite(op string, n *Note, permanently bool) error {
+	if err := s.Outbox.Add(op, n, permanently, true); err != nil {
+		return err
+	}
+	fmt.Fprintln(s.stderr(), "Network unavailable, change queued. Run `gonote sync` to send it.")
+	return nil
+}
+
+// SyncNotes replays writes queued while offline.
+func (s *simpleNoteClient) syncNotes() error {
+	sent, conflicts, err := s.Outbox.Replay(s.Store, s.synced)
+	for _, key := range conflicts {
+		fmt.Fprintf(os.Stderr, "Note %s was changed elsewhere, resolve conflicts with `gonote edit %s`.\n", key, key)
+	}
+	if err == nil {
+		err = s.Index.Save()
+	}
+	if err == nil {
+		err = s.Aliases.Save()
+	}
+	if err != nil {
+		pending, _ := s.Outbox.Len()
+		return errors.New(fmt.Sprintf("Synced %d changes, %d still queued: %s", sent, pending, err))
+	}
+	fmt.Printf("Synced %d changes.\n", sent)
+	return nil
+}
+
+// synced updates local copies of the note written by replayed outbox entry.
+func (s *simpleNoteClient) synced(entry *outboxEntry) error {
+	n := &entry.Note
+	if entry.Op == outboxDelete {
+		return s.forgetNote(n.Key, entry.Permanently)
+	}
+	if err := s.Cache.Put(n); err != nil {
+		return err
+	}
+	if entry.Op == outboxCreate {
+		s.Aliases.Handle(n.Key)
+	}
+	return s.Index.Add(n)
 }
 
 // EditNote edits the note in given editor then updates it's contents in SimpleNote.
+// If the note was changed elsewhere in the meantime, both changes are merged.
 func (s *simpleNoteClient) editNote() (err error) {
-	// TODO: update version for the note to allow reverting to previous version.
 	n := &Note{
 		Key: s.Params.Key,
 	}
-	note := s.fetchNote(n)
+	note, err := s.fetchNote(n)
+	if err != nil {
+		return err
+	}
 	updatedContent, err := WriteToFile(note.Content)
 	if err != nil {
 		return err
 	}
-	note.Content = strings.TrimSpace(updatedContent)
+	base := note
+	local := strings.TrimSpace(updatedContent)
+	for {
+		remote, err := s.Store.Fetch(note.Key)
+		if err != nil {
+			if IsNetworkError(err) {
+				// Can't check for conflicts now, change will be queued.
+				break
+			}
+			return err
+		}
+		if remote.ModifyDate == base.ModifyDate {
+			break
+		}
+		merged, clean := MergeText(base.Content, local, remote.Content)
+		note, base = *remote, *remote
+		if clean {
+			fmt.Println("Note was changed elsewhere, changes merged.")
+			local = merged
+			break
+		}
+		fmt.Println("Note was changed elsewhere, resolve conflicts in the editor.")
+		if updatedContent, err = WriteToFile(merged); err != nil {
+			return err
+		}
+		local = strings.TrimSpace(updatedContent)
+	}
+	note.Content = local
 	return s.updateNote(&note)
 }
 
 // DeleteNote deletes the note with given key
 func (s *simpleNoteClient) deleteNote() (err error) {
-	// TODO: update version for the note to allow reverting to previous version.
-	n := &Note{
-		Key: s.Params.Key,
+	if err = s.Store.Trash(s.Params.Key); err != nil {
+		if IsNetworkError(err) {
+			return s.queueWrite(outboxDelete, &Note{Key: s.Params.Key}, s.Params.Flags["permanently"] == "true")
+		}
+		return
+	}
+	fmt.Fprintln(s.stdout(), "Note updated.")
+	permanently := s.Params.Flags["permanently"] == "true"
+	if permanently {
+		if err = s.Store.Purge(s.Params.Key); err != nil {
+			return
+		}
+	}
+	if err = s.forgetNote(s.Params.Key, permanently); err != nil {
+		return
 	}
-	note := s.fetchNote(n)
-	note.Deleted = 1
-	if err = s.updateNote(&note); err != nil {
+	if err = s.Aliases.Save(); err != nil {
 		return
 	}
-	if s.Params.Flags["permanently"] == "true" {
-		// Permanently delete the note
-		_, err, code := s.makeRequest(fmt.Sprintf("%s%s/%s", baseUrl, dataEndpoint, note.Key), http.MethodDelete, nil, nil)
+	return s.Index.Save()
+}
+
+// forgetNote updates local copies of the note deleted from the store.
+func (s *simpleNoteClient) forgetNote(key string, permanently bool) error {
+	if !permanently {
+		return s.Index.Trash(key)
+	}
+	if err := s.Index.Remove(key); err != nil {
+		return err
+	}
+	if err := s.Aliases.Remove(key); err != nil {
+		return err
+	}
+	return s.Cache.Remove(key)
+}
+
+// ShowHistory lists all kept versions of the note, newest first.
+func (s *simpleNoteClient) showHistory() error {
+	note, err := s.Store.Fetch(s.Params.Key)
+	if err != nil {
+		return err
+	}
+	minVersion := note.MinVersion
+	if minVersion < 1 {
+		minVersion = 1
+	}
+	records := []string{}
+	for v := note.Version; v >= minVersion; v-- {
+		n := note
+		if v != note.Version {
+			if n, err = s.Store.FetchVersion(note.Key, v); err != nil {
+				return err
+			}
+		}
+		records = append(records, fmt.Sprintf(noteHistoryRecord, redColored(fmt.Sprintf("Version %d", v)), cyanColored(HumanDate(n.ModifyDate)), noteHeader(n)))
+	}
+	fmt.Printf("Showing %s versions of %s:\n%s\n", blueColored(len(records)), note.Key, strings.Join(records, "\n"))
+	return nil
+}
+
+// ShowVersion prints the note as it was in version passed by the user, or current one if not given.
+func (s *simpleNoteClient) showVersion() error {
+	version, _ := strconv.Atoi(s.Params.Flags["version"])
+	if version < 1 {
+		retrieved, err := s.fetchNote(&Note{Key: s.Params.Key})
 		if err != nil {
 			return err
 		}
-		if code != http.StatusOK {
-			return errors.New(fmt.Sprintf("Simplenote request failed. Code was: %d", code))
-		}
+		return s.showNote(&retrieved)
 	}
-	return
+	n, err := s.Store.FetchVersion(s.Params.Key, version)
+	if err != nil {
+		return err
+	}
+	n.Key = s.Params.Key
+	return s.showNote(n)
+}
 
+// RestoreNote replaces note content and tags with ones from version passed by the user.
+func (s *simpleNoteClient) restoreNote() error {
+	version, err := strconv.Atoi(s.Params.Flags["version"])
+	if err != nil {
+		return err
+	}
+	old, err := s.Store.FetchVersion(s.Params.Key, version)
+	if err != nil {
+		return err
+	}
+	note, err := s.Store.Fetch(s.Params.Key)
+	if err != nil {
+		return err
+	}
+	note.Content = old.Content
+	note.Tags = old.Tags
+	note.Deleted = 0
+	if err = s.updateNote(note); err != nil {
+		return err
+	}
+	fmt.Printf("Note restored to version %d.\n", version)
+	return nil
 }
 
 // ListNotes fetches all user notes and displays them in terminal.
-func (s *simpleNoteClient) listNotes() (err error) {
-	notes := []Note{}
-	notes, err = s.getAllNotes(notes, "")
-	noteCh := make(chan Note, len(notes))
+// Notes are shown most recent first as index pages arrive, listing stops
+// as soon as number of notes requested by the user was shown. Sorting each
+// page is enough, as note stores list newer notes on earlier pages.
+func (s *simpleNoteClient) listNotes() error {
+	limit, err := strconv.Atoi(s.Params.Flags["n"])
+	if err != nil {
+		limit = -1
+	}
+	out, err := s.newNoteListWriter()
 	if err != nil {
 		return err
 	}
-	if len(notes) == 0 {
-		s.showNotes([]Note{})
-		return
+	pages := s.notePages()
+	offline := false
+	for first := true; ; first = false {
+		page, err := pages.Next()
+		if err != nil {
+			cached, ok := s.cachedNotes(err)
+			if !first || !ok {
+				return err
+			}
+			page = cached
+			pages.done, offline = true, true
+		}
+		if page == nil {
+			break
+		}
+		notes, err := s.fetchNotes(page)
+		if err != nil {
+			return err
+		}
+		if err = s.indexNotes(notes); err != nil {
+			return err
+		}
+		sort.Stable(sort.Reverse(notes))
+		for _, n := range notes {
+			if limit >= 0 && out.count >= limit {
+				break
+			}
+			if n.Content == "" { // Don't show empty notes
+				continue
+			}
+			if err = out.Write(&n); err != nil {
+				return err
+			}
+		}
+		if limit >= 0 && out.count >= limit {
+			// Rest of the index is not needed.
+			break
+		}
+	}
+	if !offline {
+		if err = s.prune(pages); err != nil {
+			return err
+		}
+	}
+	if err = s.Index.Save(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// SearchNotes displays notes matching user query, most relevant first.
+// Search index is refreshed with notes changed since last run, then only
+// notes which may match the query according to the index are read.
+func (s *simpleNoteClient) searchNotes() error {
+	q, err := ParseQuery(s.Params.Query)
+	if err != nil {
+		return err
+	}
+	entries, err := s.getAllNotes()
+	if err != nil {
+		if !IsNetworkError(err) {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Network unavailable, searching cached notes.")
+		entries = s.indexedNotes()
+	} else if err = s.refreshIndex(entries); err != nil {
+		return err
+	}
+	candidates := q.Candidates(s.Index)
+	matching := Notes{}
+	for _, n := range entries {
+		if candidates == nil || candidates[n.Key] {
+			matching = append(matching, n)
+		}
+	}
+	notes, err := s.fetchNotes(matching)
+	if err != nil {
+		return err
+	}
+	results := Search(q, notes)
+	if limit, err := strconv.Atoi(s.Params.Flags["n"]); err == nil && limit >= 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	parsed := make([]string, len(results))
+	for i, r := range results {
+		parsed[i] = fmt.Sprintf(noteListRecord, s.keyLabel(&r.Note), cyanColored(HumanDate(r.Note.ModifyDate)), blueColored(ParseTags(r.Note.Tags)), r.Snippet())
+	}
+	fmt.Printf(noteSearchBody, blueColored(len(parsed)), s.Params.Query, strings.Join(parsed, "\n"))
+	return s.Aliases.Save()
+}
+
+// refreshIndex updates search index with notes which changed since they were indexed.
+func (s *simpleNoteClient) refreshIndex(entries Notes) error {
+	stale := Notes{}
+	for _, n := range entries {
+		if s.Index.Stale(&n) {
+			stale = append(stale, n)
+		}
+	}
+	notes, err := s.fetchNotes(stale)
+	if err != nil {
+		return err
 	}
 	for _, n := range notes {
-		go func(n Note) {
-			noteCh <- s.fetchNote(&n)
-		}(n)
+		if err = s.Index.Add(&n); err != nil {
+			return err
+		}
 	}
-	reqTimeout := time.After(defaultNoteFetchTimeout * time.Second)
-	fullNotes := []Note{}
-	for {
-		select {
-		case retrieved := <-noteCh:
-			fullNotes = append(fullNotes, retrieved)
-			if len(fullNotes) == len(notes) {
-				s.showNotes(fullNotes)
-				return
+	return s.Index.Save()
+}
+
+// GetNotes retrieves full contents of all notes matching user filters.
+func (s *simpleNoteClient) getNotes() (Notes, error) {
+	notes, err := s.getAllNotes()
+	if err != nil {
+		if cached, ok := s.cachedNotes(err); ok {
+			return cached, nil
+		}
+		return nil, err
+	}
+	fullNotes, err := s.fetchNotes(notes)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.indexNotes(fullNotes); err != nil {
+		return nil, err
+	}
+	return fullNotes, s.Index.Save()
+}
+
+// indexNotes adds notes which changed since they were indexed to the search index.
+func (s *simpleNoteClient) indexNotes(notes Notes) error {
+	for _, n := range notes {
+		if s.Index.Stale(&n) {
+			if err := s.Index.Add(&n); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FetchNotes retrieves full contents of notes with given index entries, using pool of workers.
+// Notes which did not change since last run are served from the cache, ones with content
+// already included in the index are used as they are. Notes which could
+// not be retrieved are skipped, warning listing their keys is shown instead.
+func (s *simpleNoteClient) fetchNotes(notes Notes) (Notes, error) {
+	fullNotes := Notes{}
+	jobs := make(chan Note)
+	results := make(chan fetchResult)
+	workers := s.Cfg.FetchWorkers
+	if workers < 1 {
+		workers = defaultFetchWorkers
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for n := range jobs {
+				retrieved, err := s.fetchNote(&n)
+				results <- fetchResult{Key: n.Key, Note: retrieved, Err: err}
 			}
-		case <-reqTimeout:
-			return errors.New("Timeout when fetching notes")
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, n := range notes {
+			if s.withContent[n.Key] {
+				// Content came with the index, no need to ask for it again.
+				s.cacheNote(&n)
+				results <- fetchResult{Key: n.Key, Note: n}
+				continue
+			}
+			if cached, ok := s.Cache.Fresh(&n); ok {
+				results <- fetchResult{Key: n.Key, Note: *cached}
+				continue
+			}
+			jobs <- n
+		}
+	}()
+	failed := []string{}
+	var lastErr error
+	for range notes {
+		r := <-results
+		if r.Err != nil {
+			failed = append(failed, r.Key)
+			lastErr = r.Err
+			continue
+		}
+		fullNotes = append(fullNotes, r.Note)
+	}
+	if len(failed) > 0 {
+		if len(fullNotes) == 0 {
+			return nil, lastErr
 		}
+		sort.Strings(failed)
+		fmt.Fprintf(os.Stderr, "Warning: could not fetch %d of %d notes, last error was: %s\nMissing notes: %s\n",
+			len(failed), len(notes), lastErr, strings.Join(failed, ", "))
 	}
+	return fullNotes, nil
+}
+
+// fetchResult represents outcome of fetching single note.
+type fetchResult struct {
+	Key  string
+	Note Note
+	Err  error
+}
+
+// cachedNotes returns notes from the cache matching user filters if the index could
+// not be retrieved due to network failure. Filters are answered by search index,
+// only cached notes missing from it are read to be checked.
+func (s *simpleNoteClient) cachedNotes(err error) (Notes, bool) {
+	if s.Cache == nil || !IsNetworkError(err) {
+		return nil, false
+	}
+	keys, cacheErr := s.Cache.Keys()
+	if cacheErr != nil {
+		return nil, false
+	}
+	fmt.Fprintln(os.Stderr, "Network unavailable, showing cached notes.")
+	matching := make(map[string]bool)
+	for _, n := range s.indexedNotes() {
+		matching[n.Key] = true
+	}
+	notes := Notes{}
+	for _, k := range keys {
+		_, indexed := s.Index.Doc(k)
+		if indexed && !matching[k] {
+			continue
+		}
+		if n, ok := s.Cache.Get(k); ok && (indexed || s.matchesFilters(n)) {
+			notes = append(notes, *n)
+		}
+	}
+	return notes, true
 }
 
 // ParseNote returns prettified version of the note record.
 func (s *simpleNoteClient) parseNote(note *Note, shorten bool) string {
+	var content string
+	if shorten {
+		content = noteHeader(note)
+	} else {
+		content = strings.Join(noteLines(note), "\n")
+	}
+	return fmt.Sprintf(noteListRecord, s.keyLabel(note), cyanColored(HumanDate(note.ModifyDate)), blueColored(ParseTags(note.Tags)), content)
+}
+
+// keyLabel returns note key together with its short handle.
+func (s *simpleNoteClient) keyLabel(note *Note) string {
+	if note.Key == "" {
+		// Note created offline gets its key once synced.
+		return redColored(queuedNoteLabel)
+	}
+	if handle := s.Aliases.Handle(note.Key); handle != "" {
+		return fmt.Sprintf("%s [%s]", redColored(note.Key), handle)
+	}
+	return redColored(note.Key)
+}
+
+// noteLines returns lines of the note content, skipping leading empty ones.
+func noteLines(note *Note) []string {
 	// Generally we should not have notes with whitespace at the end or beggining...
 	// But it won't hurt :D...
 	lines := strings.Split(note.Content, "\n")
 	for i, line := range lines {
 		if line != "" {
-			lines = lines[i:]
-			break
+			return lines[i:]
 		}
 	}
-	var content string
-	if len(lines) > 0 {
-		if shorten {
-			if noteHeaderLength < len(lines[0]) {
-				content = lines[0][:noteHeaderLength] + "..."
-			} else {
-				content = lines[0]
-			}
-		} else {
-			content = strings.Join(lines, "\n")
-		}
+	return lines
+}
 
+// noteHeader returns first line of the note, shortened to fit in the list.
+func noteHeader(note *Note) string {
+	lines := noteLines(note)
+	if noteHeaderLength < len(lines[0]) {
+		return lines[0][:noteHeaderLength] + "..."
 	}
-	return fmt.Sprintf(noteListRecord, redColored(note.Key), cyanColored(HumanDate(note.ModifyDate)), blueColored(ParseTags(note.Tags)), content)
+	return lines[0]
 }
 
-// ShowNotes displays fetched list of notes to the user.
-func (s *simpleNoteClient) showNotes(notes Notes) {
-	sort.Sort(notes)
-	parsed := []string{}
-	for _, n := range notes {
-		if n.Content != "" { // Don't show empty notes
-			parsed = append(parsed, s.parseNote(&n, true))
-		}
+// noteListWriter shows notes of the list one by one, as they are retrieved.
+// Structured formats which need the whole list at once are written when closed.
+type noteListWriter struct {
+	client *simpleNoteClient
+	enc    noteEncoder
+	tmpl   *noteTemplate
+	held   Notes // Notes waiting to be encoded
+	count  int
+}
+
+// newNoteListWriter returns writer using output format selected by the user.
+func (s *simpleNoteClient) newNoteListWriter() (*noteListWriter, error) {
+	w := &noteListWriter{client: s}
+	if enc, ok := s.encoder(); ok {
+		w.enc = enc
+		return w, nil
+	}
+	tmpl, err := s.template(s.Cfg.ListFormat)
+	if err != nil {
+		return nil, err
 	}
-	if s.Params.Flags["n"] != "-1" {
-		n, err := strconv.Atoi(s.Params.Flags["n"])
-		if err != nil {
-			n = len(parsed)
+	w.tmpl = tmpl
+	return w, nil
+}
+
+// Write shows single note of the list.
+func (w *noteListWriter) Write(n *Note) (err error) {
+	w.count++
+	switch {
+	case w.enc != nil:
+		if streamed(w.enc) {
+			return w.enc.EncodeNote(os.Stdout, n)
 		}
-		if n > len(parsed) {
-			n = len(parsed)
+		w.held = append(w.held, *n)
+	case w.tmpl != nil:
+		return w.tmpl.Render(os.Stdout, n)
+	default:
+		if w.count == 1 {
+			w.header()
 		}
-		cut := len(parsed) - n
-
-		parsed = parsed[cut:]
+		_, err = fmt.Println(w.client.parseNote(n, true))
 	}
-	fmt.Printf(noteListBody, blueColored(len(parsed)), s.Cfg.Email, strings.Join(parsed, "\n"))
 	return
 }
 
+// Close finishes the list.
+func (w *noteListWriter) Close() error {
+	switch {
+	case w.enc != nil:
+		if streamed(w.enc) {
+			return nil
+		}
+		return w.enc.EncodeNotes(os.Stdout, w.held)
+	case w.tmpl != nil:
+		return nil
+	}
+	if w.count == 0 {
+		w.header()
+	}
+	fmt.Printf(noteListFooter, blueColored(w.count))
+	return w.client.Aliases.Save()
+}
+
+func (w *noteListWriter) header() {
+	owner := w.client.Cfg.Email
+	if w.client.Cfg.Backend == localBackend {
+		owner = w.client.Cfg.NotesDir
+	}
+	fmt.Printf(noteListHeader, owner)
+}
+
 // Show note prints single note to the user
-func (s *simpleNoteClient) showNote(note *Note) {
+func (s *simpleNoteClient) showNote(note *Note) error {
+	if enc, ok := s.encoder(); ok {
+		return enc.EncodeNote(os.Stdout, note)
+	}
+	if tmpl, err := s.template(s.Cfg.GetFormat); tmpl != nil || err != nil {
+		if err != nil {
+			return err
+		}
+		return tmpl.Render(os.Stdout, note)
+	}
 	fmt.Printf(s.parseNote(note, false))
-	return
+	return s.Aliases.Save()
 }
 
-// createNote creates new note using SimpleNote API.
+// template returns output template passed by the user, or configured one if not given.
+// Returns nil if no template was set.
+func (s *simpleNoteClient) template(configured string) (*noteTemplate, error) {
+	format := s.Params.Flags["format"]
+	if format == "" {
+		format = configured
+	}
+	if format == "" {
+		return nil, nil
+	}
+	return newNoteTemplate(format)
+}
+
+// encoder returns encoder for structured output format selected by the user, if any.
+func (s *simpleNoteClient) encoder() (noteEncoder, bool) {
+	enc, err := newNoteEncoder(s.Params.Flags["output"])
+	return enc, err == nil
+}
+
+// createNote creates new note using configured note store.
 func (s *simpleNoteClient) createNote() (n *Note, err error) {
 	n = &Note{
 		Content:    s.Params.Content,
@@ -301,154 +825,113 @@ func (s *simpleNoteClient) createNote() (n *Note, err error) {
 	if s.Cfg.Markdown {
 		n.SystemTags = append(n.SystemTags, "markdown")
 	}
-	data, err := json.Marshal(n)
+	// Creation date lets sync recognise the note if request times out after reaching the server.
+	n.CreateDate = SimpleNoteTimestamp(time.Now())
+	n.ModifyDate = n.CreateDate
+	newNote, err := s.Store.Create(n)
 	if err != nil {
-		return
-	}
-	resp, err, code := s.makeRequest(fmt.Sprintf("%s%s", baseUrl, dataEndpoint), http.MethodPost, bytes.NewReader(data), nil)
-	if err != nil {
-		return
-	} else if code != http.StatusOK {
-		return n, errors.New(fmt.Sprintf("Simplenote request failed. Code was: %d", code))
+		if IsNetworkError(err) {
+			return n, s.queueWrite(outboxCreate, n, false)
+		}
+		return n, err
 	}
 	// When creating the note we don't get 'content' field in return so we have to copy it.
 	// In order to print it back to the user.
-	newNote := Note{}
-	if err = json.Unmarshal(resp, &newNote); err != nil {
-		return
-	}
 	newNote.Content = n.Content
-	// We don't actually need any response data when creating new notes.
-	// TODO: if we use shortened urls we'll need to update keys file at this time.
-	return &newNote, nil
-}
-
-// FetchNote retrieves single note contents.
-func (s *simpleNoteClient) fetchNote(n *Note) Note {
-	resp, err, code := s.makeRequest(fmt.Sprintf("%s%s/%s", baseUrl, dataEndpoint, n.Key), http.MethodGet, nil, nil)
-	if err != nil {
-		log.Fatal(err)
+	if err = s.Cache.Put(newNote); err != nil {
+		return newNote, err
 	}
-	i := Note{}
-	if code != http.StatusOK {
-		err = errors.New(fmt.Sprintf("Simplenote request failed. Code was: %d", code))
-		log.Fatal(err)
-	} else if err = json.Unmarshal(resp, &i); err != nil {
-		log.Fatal(err)
+	if err = s.Index.Add(newNote); err != nil {
+		return newNote, err
 	}
-	return i
+	if err = s.Index.Save(); err != nil {
+		return newNote, err
+	}
+	// Give the note short handle right away, so it can be referenced with it.
+	s.Aliases.Handle(newNote.Key)
+	return newNote, s.Aliases.Save()
 }
 
-// GetAllNotes retrieves all notes from SimpleNote user account.
-func (s *simpleNoteClient) getAllNotes(notes Notes, mark string) (Notes, error) {
-	qparams := map[string]string{"length": strconv.Itoa(defaultNoteAmount)}
-	if mark != "" {
-		qparams["mark"] = mark
-	}
-	resp, err, code := s.makeRequest(fmt.Sprintf("%s%s", baseUrl, indexEndpoint), http.MethodGet, nil, qparams)
+// FetchNote retrieves single note contents, falling back to cached copy when offline.
+func (s *simpleNoteClient) fetchNote(n *Note) (Note, error) {
+	i, err := s.Store.Fetch(n.Key)
 	if err != nil {
-		return []Note{}, err
-
-	} else if code != http.StatusOK {
-		return []Note{}, errors.New(fmt.Sprintf("Simplenote request failed. Code was: %s", code))
-	}
-	l := NoteList{}
-	if err = json.Unmarshal(resp, &l); err != nil {
-		return []Note{}, err
-	}
-	for _, n := range l.Data {
-		// Filter out notes by passed tags if any.
-		if s.Params.Flags["deleted"] != "true" && n.Deleted == 1 {
-			continue
-		}
-		if len(s.Params.Tags) > 0 {
-			for _, t := range s.Params.Tags {
-				if CheckIn(t, n.Tags) {
-					notes = append(notes, n)
-					break
-				}
-			}
-		} else {
-			notes = append(notes, n)
+		if cached, ok := s.Cache.Get(n.Key); ok && IsNetworkError(err) {
+			s.offlineNotice.Do(func() {
+				fmt.Fprintln(s.stderr(), "Network unavailable, showing cached notes.")
+			})
+			return *cached, nil
 		}
+		return Note{}, err
 	}
-	if l.Mark != "" {
-		// Retrieve next part of the list and append.
-		newNotes, err := s.getAllNotes(notes, mark)
+	s.cacheNote(i)
+	return *i, nil
+}
+
+// GetAllNotes retrieves index entries of all notes matching user filters.
+// Notes deleted elsewhere are removed from the cache and search index.
+func (s *simpleNoteClient) getAllNotes() (Notes, error) {
+	notes := Notes{}
+	pages := s.notePages()
+	for {
+		page, err := pages.Next()
 		if err != nil {
-			return []Note{}, err
+			return nil, err
+		}
+		if page == nil {
+			return notes, s.prune(pages)
 		}
-		notes = append(notes, newNotes...)
+		notes = append(notes, page...)
 	}
-	return notes, nil
 }
 
-// Authorize retrieves access token used for calling SimpleNote servers.
-func (s *simpleNoteClient) Authorize() (err error) {
-	body := fmt.Sprintf("email=%s&password=%s", s.Cfg.Email, s.Cfg.Password)
-	encodedBody := base64.StdEncoding.EncodeToString([]byte(body))
-	req, err := http.NewRequest(http.MethodPost, authorizeUrl, strings.NewReader(encodedBody))
-	if err != nil {
-		return
-	}
-	resp, err := s.Client.Do(req)
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return errors.New(fmt.Sprintf("Error authorizing the client, check if username or password are valid. Status code was : %d", resp.StatusCode))
-	}
-	code, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return
+// indexedNotes queries search index for entries of notes matching user filters.
+func (s *simpleNoteClient) indexedNotes() Notes {
+	since, _ := strconv.ParseFloat(s.Params.Flags["since"], 64)
+	keys := s.Index.Filter(func(d *indexedNote) bool {
+		return s.matchesFilters(&Note{Tags: d.Tags, Deleted: d.Deleted}) && float64(GetSimpleNoteTimestamp(d.ModifyDate)) >= since
+	})
+	notes := Notes{}
+	for _, n := range s.Index.All() {
+		if keys[n.Key] {
+			notes = append(notes, n)
+		}
 	}
-	s.Token = string(code)
-	return
+	return notes
 }
 
-func (s *simpleNoteClient) parseAddr(req *http.Request, params map[string]string) {
-	vals := req.URL.Query()
-	p := map[string]string{
-		"auth":  s.Token,
-		"email": s.Cfg.Email,
+// matchesFilters checks if note should be listed, given deleted flag and tags passed by the user.
+func (s *simpleNoteClient) matchesFilters(n *Note) bool {
+	if s.Params.Flags["deleted"] != "true" && n.Deleted == 1 {
+		return false
 	}
-	if params != nil {
-		for k, v := range params {
-			p[k] = v
-		}
+	if len(s.Params.Tags) == 0 {
+		return true
 	}
-	for k, v := range p {
-		vals.Add(k, v)
+	for _, t := range s.Params.Tags {
+		if CheckIn(t, n.Tags) {
+			return true
+		}
 	}
-	req.URL.RawQuery = vals.Encode()
+	return false
 }
 
-// Basic HTTP handler used for all SimpleNote requests (except Authorize).
-func (s *simpleNoteClient) makeRequest(addr, method string, body io.Reader, additionalParams map[string]string) (response []byte, err error, code int) {
-	req, err := http.NewRequest(method, addr, body)
-	if err != nil {
-		return
-	}
-	s.parseAddr(req, additionalParams)
-	for headerName, headerVal := range simpleNoteHeaders {
-		req.Header.Set(headerName, headerVal)
-	}
-	resp, err := s.Client.Do(req)
-	defer resp.Body.Close()
-	if err != nil {
-		return
+// Authorize prepares underlying note store for use.
+func (s *simpleNoteClient) Authorize() error {
+	if s.Params.Action == "logout" {
+		// No point logging in just to log out.
+		return nil
 	}
-	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized {
-		if err = s.Authorize(); err != nil {
-			return
-		}
-		return s.makeRequest(addr, method, body, additionalParams)
-	} else if resp.StatusCode == http.StatusInternalServerError || resp.StatusCode == http.StatusPreconditionFailed {
-		return s.makeRequest(addr, method, body, additionalParams)
+	return s.Store.Authorize()
+}
+
+// Logout removes saved access token, so credentials are needed again on the next run.
+func (s *simpleNoteClient) logout() error {
+	if err := s.Store.Logout(); err != nil {
+		return err
 	}
-	response, err = ioutil.ReadAll(resp.Body)
-	return response, err, resp.StatusCode
+	fmt.Println("Logged out.")
+	return nil
 }
 
 func (notes Notes) Len() int {
@@ -0,0 +1,248 @@
+package simplenote
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBaseURL     = "https://simple-note.appspot.com"
+	DefaultUserAgent   = "simplenote-go"
+	DefaultTimeout     = 30 * time.Second // Limit for single attempt, including reading the response
+	DefaultMaxAttempts = 5
+
+	loginPath = "/api/login"
+	dataPath  = "/api2/data"
+	indexPath = "/api2/index"
+)
+
+// Client talks to SimpleNote on behalf of single user. It is safe for concurrent use.
+type Client struct {
+	email       string
+	baseURL     string
+	httpClient  *http.Client
+	userAgent   string
+	timeout     time.Duration
+	maxAttempts int
+
+	mu    sync.RWMutex
+	token string
+}
+
+// Option changes default client settings.
+type Option func(c *Client)
+
+// WithBaseURL sets address of SimpleNote server, e.g. to use test server.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithHTTPClient sets HTTP client used for sending requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithUserAgent sets User-Agent header sent with each request.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithTimeout sets time limit of single request attempt.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithMaxAttempts sets how many times request failing with server error is sent.
+func WithMaxAttempts(attempts int) Option {
+	return func(c *Client) {
+		c.maxAttempts = attempts
+	}
+}
+
+// WithToken sets access token obtained earlier, so Login does not have to be called.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// NewClient returns client for account with given email.
+func NewClient(email string, opts ...Option) *Client {
+	c := &Client{
+		email:       email,
+		baseURL:     DefaultBaseURL,
+		httpClient:  http.DefaultClient,
+		userAgent:   DefaultUserAgent,
+		timeout:     DefaultTimeout,
+		maxAttempts: DefaultMaxAttempts,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.httpClient == nil {
+		c.httpClient = http.DefaultClient
+	}
+	if c.timeout <= 0 {
+		c.timeout = DefaultTimeout
+	}
+	if c.maxAttempts < 1 {
+		c.maxAttempts = 1
+	}
+	return c
+}
+
+// Email returns email of the account client works with.
+func (c *Client) Email() string {
+	return c.email
+}
+
+// Token returns access token sent with requests, empty if client did not log in.
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+// SetToken replaces access token sent with requests.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+// Login exchanges user password for new access token, which is used by following requests.
+func (c *Client) Login(ctx context.Context, password string) error {
+	form := url.Values{"email": {c.email}, "password": {password}}
+	body := base64.StdEncoding.EncodeToString([]byte(form.Encode()))
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+loginPath, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	if resp.Code != http.StatusOK {
+		return &APIError{Status: resp.Code, Body: resp.Body}
+	}
+	c.SetToken(string(resp.Body))
+	return nil
+}
+
+// Index retrieves single page of the note list. SimpleNote lists most recently
+// modified notes first. Notes with contents included are listed in WithContent field.
+func (c *Client) Index(ctx context.Context, opts IndexOptions) (*NoteList, error) {
+	params := url.Values{}
+	if opts.Length > 0 {
+		params.Set("length", strconv.Itoa(opts.Length))
+	}
+	if opts.Mark != "" {
+		params.Set("mark", opts.Mark)
+	}
+	if opts.Content {
+		params.Set("data", "true")
+	}
+	if opts.Since > 0 {
+		params.Set("since", strconv.FormatFloat(opts.Since, 'f', 6, 64))
+	}
+	resp, err := c.request(ctx, http.MethodGet, indexPath, nil, params)
+	if err != nil {
+		return nil, err
+	}
+	l := &NoteList{}
+	if err = json.Unmarshal(resp, l); err != nil {
+		return nil, err
+	}
+	l.WithContent = make(map[string]bool)
+	if opts.Content {
+		// Server may leave content out, such notes have to be fetched one by one.
+		raw := &struct {
+			Data []map[string]json.RawMessage `json:"data"`
+		}{}
+		if err = json.Unmarshal(resp, raw); err != nil {
+			return nil, err
+		}
+		for i := range raw.Data {
+			if _, ok := raw.Data[i]["content"]; ok && i < len(l.Data) {
+				l.WithContent[l.Data[i].Key] = true
+			}
+		}
+	}
+	return l, nil
+}
+
+// Get retrieves current version of the note.
+func (c *Client) Get(ctx context.Context, key string) (*Note, error) {
+	return c.note(ctx, http.MethodGet, fmt.Sprintf("%s/%s", dataPath, url.PathEscape(key)), nil)
+}
+
+// GetVersion retrieves note contents as they were in given version.
+func (c *Client) GetVersion(ctx context.Context, key string, version int) (*Note, error) {
+	return c.note(ctx, http.MethodGet, fmt.Sprintf("%s/%s/%d", dataPath, url.PathEscape(key), version), nil)
+}
+
+// Create saves new note, returning it with key and dates set by the server.
+// SimpleNote does not send content of the note back.
+func (c *Client) Create(ctx context.Context, n *Note) (*Note, error) {
+	return c.note(ctx, http.MethodPost, dataPath, n)
+}
+
+// Update saves all the fields of the note with given key.
+func (c *Client) Update(ctx context.Context, n *Note) (*Note, error) {
+	return c.note(ctx, http.MethodPost, fmt.Sprintf("%s/%s", dataPath, url.PathEscape(n.Key)), n)
+}
+
+// Trash moves the note to trash.
+func (c *Client) Trash(ctx context.Context, key string) error {
+	n, err := c.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	n.Deleted = 1
+	_, err = c.Update(ctx, n)
+	return err
+}
+
+// Delete permanently deletes the note, SimpleNote requires it to be in trash first.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	_, err := c.request(ctx, http.MethodDelete, fmt.Sprintf("%s/%s", dataPath, url.PathEscape(key)), nil, nil)
+	return err
+}
+
+// note sends request with optional note as body and decodes note from the response.
+func (c *Client) note(ctx context.Context, method, path string, n *Note) (*Note, error) {
+	var body []byte
+	if n != nil {
+		var err error
+		if body, err = json.Marshal(n); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := c.request(ctx, method, path, body, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := &Note{}
+	if err = json.Unmarshal(resp, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package simplenote
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc, opts ...Option) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewClient("user@example.com", append([]Option{WithBaseURL(server.URL + "/"), WithHTTPClient(server.Client())}, opts...)...)
+}
+
+func TestLogin(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		decoded, _ := base64.StdEncoding.DecodeString(string(body))
+		form, _ := url.ParseQuery(string(decoded))
+		if r.URL.Path != loginPath || form.Get("email") != "user@example.com" || form.Get("password") != "p&ss word" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "token")
+	})
+	if err := c.Login(context.Background(), "p&ss word"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Token() != "token" {
+		t.Errorf("Unexpected token: %q", c.Token())
+	}
+	var apiErr *APIError
+	if err := c.Login(context.Background(), "wrong"); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Errorf("Expected unauthorized error, got %v", err)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != indexPath || q.Get("auth") != "token" || q.Get("mark") != "m1" || q.Get("length") != "2" || q.Get("data") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("User-Agent") != "Test/1.0" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"count": 2, "mark": "m2", "data": [{"key": "a", "content": "Note"}, {"key": "b"}]}`)
+	}, WithToken("token"), WithUserAgent("Test/1.0"))
+	l, err := c.Index(context.Background(), IndexOptions{Mark: "m1", Length: 2, Content: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Mark != "m2" || len(l.Data) != 2 || !l.WithContent["a"] || l.WithContent["b"] {
+		t.Errorf("Unexpected note list: %+v", l)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	requests := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"key": "a", "content": "Note"}`)
+	})
+	n, err := c.Get(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Content != "Note" || requests != 3 {
+		t.Errorf("Unexpected note %+v after %d requests", n, requests)
+	}
+}
+
+func TestCreateNotRetriedOnServerError(t *testing.T) {
+	requests := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "0")
+		if requests == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	_, err := c.Create(context.Background(), &Note{Content: "Note"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadGateway {
+		t.Errorf("Expected server error, got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected create to be retried only after rate limiting, got %d requests", requests)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	requests := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "missing")
+	})
+	err := c.Delete(context.Background(), "a")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound || string(apiErr.Body) != "missing" {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected error to match ErrNotFound only, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected request not to be retried, got %d requests", requests)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Get(ctx, "a"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancelled request, got %v", err)
+	}
+}
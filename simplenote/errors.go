@@ -0,0 +1,40 @@
+package simplenote
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrNotFound     = errors.New("Note not found.")
+	ErrUnauthorized = errors.New("Not authorized, access token or credentials were rejected.")
+	ErrConflict     = errors.New("Note was changed concurrently.")
+	ErrRateLimited  = errors.New("Too many requests sent to SimpleNote.")
+)
+
+// APIError is returned when SimpleNote responds with unexpected status code.
+// It matches one of the Err* values with errors.Is, depending on the status.
+type APIError struct {
+	Status int    // HTTP status code of the response
+	Body   []byte // Response body, may be empty
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Simplenote request failed. Code was: %d", e.Status)
+}
+
+// Is reports whether the error belongs to class of errors described by target.
+func (e *APIError) Is(target error) bool {
+	switch e.Status {
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return target == ErrUnauthorized
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return target == ErrConflict
+	case http.StatusTooManyRequests:
+		return target == ErrRateLimited
+	}
+	return false
+}
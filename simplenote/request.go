@@ -0,0 +1,146 @@
+package simplenote
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+)
+
+// response represents response received from SimpleNote servers.
+type response struct {
+	Code       int
+	Body       []byte
+	RetryAfter time.Duration // Delay requested by the server, negative if none
+}
+
+// request sends authorized request to the API, returning body of successful response.
+// Body is passed as bytes, so the request can be sent again. Server errors are retried
+// with exponential backoff, network errors are returned right away.
+func (c *Client) request(ctx context.Context, method, path string, body []byte, params url.Values) ([]byte, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := c.attempt(ctx, method, path, body, params)
+		if err != nil {
+			return nil, err
+		}
+		if retryableStatus(method, path, resp.Code) && attempt < c.maxAttempts {
+			delay := resp.RetryAfter
+			if delay < 0 {
+				delay = retryDelay(attempt)
+			}
+			if err = sleepContext(ctx, delay); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.Code != http.StatusOK {
+			return nil, &APIError{Status: resp.Code, Body: resp.Body}
+		}
+		return resp.Body, nil
+	}
+}
+
+// attempt performs single attempt of the request.
+func (c *Client) attempt(ctx context.Context, method, path string, body []byte, params url.Values) (*response, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	for k, v := range params {
+		query[k] = v
+	}
+	query.Set("auth", c.Token())
+	query.Set("email", c.email)
+	req.URL.RawQuery = query.Encode()
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	return c.send(req)
+}
+
+// send sends the request and reads whole response.
+func (c *Client) send(req *http.Request) (*response, error) {
+	req.Header.Set("User-Agent", c.userAgent)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &response{
+		Code:       resp.StatusCode,
+		Body:       data,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}, nil
+}
+
+// retryableStatus checks if request failed with status worth trying again. Note may have been
+// created before server error was returned, and sending it again would add a duplicate,
+// so creating notes is retried only when the server rejected the request.
+func retryableStatus(method, path string, code int) bool {
+	if method == http.MethodPost && path == dataPath {
+		return code == http.StatusTooManyRequests || code == http.StatusPreconditionFailed
+	}
+	switch code {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout, http.StatusPreconditionFailed, http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
+
+// retryDelay returns exponential backoff delay for given attempt, randomized
+// so concurrent requests don't hit the server at the same moment.
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << uint(attempt-1)
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// parseRetryAfter reads Retry-After header, which holds either number of seconds or HTTP date.
+// Returns negative delay if the header is missing or invalid.
+func parseRetryAfter(val string) time.Duration {
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(val); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(val); err == nil {
+		delay = time.Until(date)
+	} else {
+		return -1
+	}
+	if delay < 0 {
+		return 0
+	}
+	if delay > retryMaxDelay {
+		return retryMaxDelay
+	}
+	return delay
+}
+
+// sleepContext waits for given time, returning early with error when context is cancelled.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,47 @@
+// Package simplenote is client library for SimpleNote HTTP API.
+//
+// Client is created with user email and optional settings:
+//
+//	client := simplenote.NewClient("user@example.com", simplenote.WithUserAgent("MyApp/1.0"))
+//	if err := client.Login(ctx, password); err != nil {
+//		return err
+//	}
+//	list, err := client.Index(ctx, simplenote.IndexOptions{Content: true})
+//
+// Requests failing with server errors are retried with exponential backoff.
+// Responses with unexpected status are returned as *APIError.
+package simplenote
+
+// Note represents note object returned by SimpleNote API.
+type Note struct {
+	Content    string   `json:"content"`
+	Tags       []string `json:"tags"`
+	SystemTags []string `json:"systemtags"`
+	Deleted    int      `json:"deleted,omitempty"`
+	Key        string   `json:"key,omitempty"`
+	ShareKey   string   `json:"sharekey,omitempty"`
+	PublishKey string   `json:"publishkey,omitempty"`
+	ModifyDate string   `json:"modifydate"`
+	CreateDate string   `json:"createdate"`
+	Version    int      `json:"version,omitempty"`    // Incremented each time note content changes
+	MinVersion int      `json:"minversion,omitempty"` // Oldest version still kept
+	SyncNum    int      `json:"syncnum,omitempty"`    // Incremented each time any note field changes
+}
+
+// NoteList represents list object returned by SimpleNote when calling note list endpoint.
+type NoteList struct {
+	Count int    `json:"count"`
+	Data  []Note `json:"data"`
+	Mark  string `json:"mark"` // Passed to next Index call to get following page, empty on last page
+
+	// Keys of listed notes which have their content included, so they don't have to be fetched.
+	WithContent map[string]bool `json:"-"`
+}
+
+// IndexOptions select page of the note index.
+type IndexOptions struct {
+	Mark    string  // Mark of the page returned by previous call, empty for the first page
+	Length  int     // Maximum number of notes on the page, zero for server default
+	Content bool    // Whether note contents should be included in the index
+	Since   float64 // Return only notes modified after this timestamp, zero for all notes
+}
@@ -0,0 +1,932 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/exaroth/gonote/v2/simplenote"
+	"github.com/fatih/color"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEnv runs gonote commands against fake SimpleNote server,
+// keeping all the files it writes in temporary directory.
+type testEnv struct {
+	t       *testing.T
+	server  *fakeSimpleNote
+	dir     string
+	cfg     *UserConfigFile
+	creds   CredentialProvider
+	timeout time.Duration
+	stderr  string // Output written to stderr by the last command
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	color.NoColor = true
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	return &testEnv{
+		t:      t,
+		server: newFakeSimpleNote(t),
+		dir:    dir,
+		cfg: &UserConfigFile{
+			Email:    fakeEmail,
+			Markdown: true,
+			Backend:  simpleNoteBackend,
+			Cache:    true,
+			CacheDir: filepath.Join(dir, "cache"),
+		},
+		creds: plainCredentials(fakePassword),
+	}
+}
+
+// client returns client set up the same way main does, using fresh store as each gonote run does.
+func (e *testEnv) client(params *CommandLineParams) *simpleNoteClient {
+	config := &mainConfig{Path: filepath.Join(e.dir, "gonote.json"), File: e.cfg, UserCfg: e.cfg}
+	opts := []simplenote.Option{simplenote.WithBaseURL(e.server.URL), simplenote.WithHTTPClient(e.server.Client())}
+	if e.timeout > 0 {
+		opts = append(opts, simplenote.WithTimeout(e.timeout))
+	}
+	store := newSimpleNoteStore(context.Background(), config, e.creds, opts...).(*simpleNoteStore)
+	store.Tokens = newTokenCache(filepath.Join(e.dir, "token.json"))
+	return &simpleNoteClient{
+		Store:   store,
+		Cache:   newNoteCache(e.cfg),
+		Outbox:  newOutbox(filepath.Join(e.dir, "outbox.json")),
+		Index:   newSearchIndex(filepath.Join(e.dir, "index.json")),
+		Aliases: newAliasTable(filepath.Join(e.dir, "aliases.json")),
+		Cfg:     e.cfg,
+		Params:  params,
+	}
+}
+
+// run executes command with given arguments, returning what it printed to stdout.
+func (e *testEnv) run(args ...string) (string, error) {
+	return e.runWithInput("", args...)
+}
+
+// runWithInput executes command with given text piped to its standard input.
+func (e *testEnv) runWithInput(input string, args ...string) (string, error) {
+	e.t.Helper()
+	stdin, err := os.Open(os.DevNull)
+	if input != "" {
+		path := filepath.Join(e.dir, "stdin")
+		if err = ioutil.WriteFile(path, []byte(input), 0600); err != nil {
+			e.t.Fatal(err)
+		}
+		stdin, err = os.Open(path)
+	}
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	defer stdin.Close()
+	origStdin := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = origStdin }()
+
+	var stderr string
+	out := capture(e.t, &os.Stdout, func() {
+		stderr = capture(e.t, &os.Stderr, func() {
+			parser := &commandLineParser{Params: &CommandLineParams{Flags: make(map[string]string)}, config: e.cfg}
+			if err = parser.parse(args); err != nil {
+				return
+			}
+			params := parser.Params
+			if params.Action == "help" {
+				err = showHelp(os.Stdout, params.Flags["command"])
+				return
+			}
+			if params.Action == "completion" {
+				err = printCompletionScript(os.Stdout, params.Flags["shell"])
+				return
+			}
+			if params.Action == "version" {
+				fmt.Println(ListVersion())
+				return
+			}
+			if params.Content == "" && params.Action == "" {
+				return
+			}
+			client := e.client(params)
+			if err = client.Authorize(); err != nil && !IsNetworkError(err) {
+				return
+			}
+			err = client.Handle()
+		})
+	})
+	e.stderr = stderr
+	return out, err
+}
+
+// mustRun executes command failing the test if it returned error.
+func (e *testEnv) mustRun(args ...string) string {
+	e.t.Helper()
+	out, err := e.run(args...)
+	if err != nil {
+		e.t.Fatalf("gonote %s: %s", strings.Join(args, " "), err)
+	}
+	return out
+}
+
+// editor sets EDITOR to script running given shell commands, with note file passed as $1.
+func (e *testEnv) editor(commands string) {
+	path := filepath.Join(e.dir, "editor.sh")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+commands+"\n"), 0700); err != nil {
+		e.t.Fatal(err)
+	}
+	e.t.Setenv("EDITOR", path)
+}
+
+// capture redirects given file to a pipe while f runs, returning everything written to it.
+func capture(t *testing.T, file **os.File, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := *file
+	*file = w
+	done := make(chan string)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		done <- string(data)
+	}()
+	defer func() { *file = orig }()
+	f()
+	w.Close()
+	return <-done
+}
+
+func assertContains(t *testing.T, out string, expected ...string) {
+	t.Helper()
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("Expected output to contain %q, got:\n%s", e, out)
+		}
+	}
+}
+
+func assertNotContains(t *testing.T, out string, unexpected ...string) {
+	t.Helper()
+	for _, u := range unexpected {
+		if strings.Contains(out, u) {
+			t.Errorf("Expected output not to contain %q, got:\n%s", u, out)
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	e := newTestEnv(t)
+	assertContains(t, e.mustRun("version"), ListVersion())
+	assertContains(t, e.mustRun("--version"), ListVersion())
+}
+
+func TestHelp(t *testing.T) {
+	e := newTestEnv(t)
+	out := e.mustRun("help")
+	assertContains(t, out, "Usage: gonote [@TAG...] [TEXT...]", "  list ", "List notes, most recently modified first.", "-profile string")
+	if strings.Index(out, "  list") > strings.Index(out, "  get") {
+		t.Errorf("Expected commands in fixed order, got:\n%s", out)
+	}
+	out = e.mustRun("help", "delete")
+	assertContains(t, out, "Usage: gonote delete [KEY]", "-permanently")
+	assertNotContains(t, out, "-since")
+	assertContains(t, e.mustRun("restore", "-h"), "Usage: gonote restore [KEY] VERSION")
+	if _, err := e.run("help", "hsitory"); err == nil || !strings.Contains(err.Error(), "did you mean history?") {
+		t.Errorf("Expected suggestion for unknown command, got %v", err)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	e := newTestEnv(t)
+	if _, err := e.run("lsit", "-n", "5"); err == nil || !strings.Contains(err.Error(), "did you mean list? Use `gonote -- lsit -n 5`") {
+		t.Errorf("Expected suggestion for unknown command, got %v", err)
+	}
+	if _, err := e.run("List"); err == nil || !strings.Contains(err.Error(), "did you mean list?") {
+		t.Errorf("Expected suggestion for command in wrong case, got %v", err)
+	}
+	assertContains(t, e.mustRun("--", "lsit", "-n", "5"), "lsit -n 5")
+	assertContains(t, e.mustRun("snow"), "snow")
+	assertContains(t, e.mustRun("tux"), "tux")
+	if e.server.Count() != 3 {
+		t.Errorf("Expected 3 notes to be created, got %d", e.server.Count())
+	}
+}
+
+func TestCommandFlags(t *testing.T) {
+	e := newTestEnv(t)
+	e.server.Add("first note", "work")
+	e.server.Add("second note", "work")
+	for _, args := range [][]string{{"list", "@work", "-n", "1"}, {"-n", "1", "list", "@work"}, {"list", "-n=1", "@work"}} {
+		out := e.mustRun(args...)
+		assertContains(t, out, "Showing 1 notes.", "second note")
+	}
+	if _, err := e.run("get", "-n", "1"); err == nil || !strings.Contains(err.Error(), "gonote help get") {
+		t.Errorf("Expected flag not accepted by get to be rejected, got %v", err)
+	}
+	if _, err := e.run("list", "extra"); err == nil {
+		t.Error("Expected unexpected argument to be rejected")
+	}
+	out := e.mustRun("@work", "--", "-n", "is", "not", "a", "flag")
+	assertContains(t, out, "-n is not a flag", "@work")
+}
+
+func TestCreateNoteFromStdin(t *testing.T) {
+	e := newTestEnv(t)
+	out, err := e.runWithInput("Shopping list\nmilk\n", "@home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, out, "Shopping list", "@home")
+	if e.server.Count() != 1 {
+		t.Fatalf("Expected 1 note on the server, got %d", e.server.Count())
+	}
+	key := strings.Fields(out)[0]
+	created, ok := e.server.Note(key)
+	if !ok {
+		t.Fatalf("Note %s was not created", key)
+	}
+	if created.Content != "Shopping list\nmilk\n" || strings.Join(created.Tags, ",") != "home" || !CheckIn("markdown", created.SystemTags) {
+		t.Errorf("Unexpected note created: %+v", created)
+	}
+}
+
+func TestCreateNoteFromArguments(t *testing.T) {
+	e := newTestEnv(t)
+	out := e.mustRun("@work", "call", "the", "bank")
+	assertContains(t, out, "call the bank", "@work")
+	if e.server.Count() != 1 {
+		t.Fatalf("Expected 1 note on the server, got %d", e.server.Count())
+	}
+}
+
+func TestCreateNoteInEditor(t *testing.T) {
+	e := newTestEnv(t)
+	e.editor(`echo "Written in editor" > "$1"`)
+	assertContains(t, e.mustRun(), "Written in editor")
+	e.editor(`true`)
+	e.mustRun()
+	if e.server.Count() != 1 {
+		t.Fatalf("Empty note should not be created, got %d notes", e.server.Count())
+	}
+}
+
+func TestListNotes(t *testing.T) {
+	e := newTestEnv(t)
+	e.server.Add("first note", "work")
+	e.server.Add("second note")
+	trashed := e.server.Add("trashed note")
+	e.mustRun("delete", trashed)
+
+	out := e.mustRun("list")
+	assertContains(t, out, "Showing 2 notes.", "first note", "second note", "@work")
+	assertNotContains(t, out, "trashed note")
+	if strings.Index(out, "second note") > strings.Index(out, "first note") {
+		t.Errorf("Expected most recently modified note first, got:\n%s", out)
+	}
+
+	assertContains(t, e.mustRun("list", "--deleted"), "Showing 3 notes.", "trashed note")
+	e.mustRun("list")
+	client := e.client(nil)
+	if _, ok := client.Cache.Get(trashed); !ok {
+		t.Error("Expected note in trash to stay cached")
+	}
+	if _, ok := client.Index.Doc(trashed); !ok {
+		t.Error("Expected note in trash to stay indexed")
+	}
+
+	out = e.mustRun("list", "@work")
+	assertContains(t, out, "Showing 1 notes.", "first note")
+	assertNotContains(t, out, "second note")
+}
+
+func TestListPagination(t *testing.T) {
+	e := newTestEnv(t)
+	for i := 0; i < 2*defaultNoteAmount+50; i++ {
+		e.server.Add(fmt.Sprintf("note number %d", i))
+	}
+	assertContains(t, e.mustRun("list"), fmt.Sprintf("Showing %d notes.", 2*defaultNoteAmount+50), "note number 0\n", "note number 249\n")
+	if requests := e.server.Requests("GET", "/api2/index"); requests != 3 {
+		t.Errorf("Expected 3 index pages to be requested, got %d", requests)
+	}
+	if requests := e.server.Requests("GET", "/api2/data"); requests != 0 {
+		t.Errorf("Expected contents to come with the index, got %d note requests", requests)
+	}
+}
+
+func TestListWithWarmCache(t *testing.T) {
+	e := newTestEnv(t)
+	keys := []string{}
+	for i := 0; i < 3; i++ {
+		keys = append(keys, e.server.Add(fmt.Sprintf("note number %d", i)))
+	}
+	e.mustRun("list")
+	e.server.Change(keys[1], "changed note")
+	assertContains(t, e.mustRun("list"), "Showing 3 notes.", "note number 0\n", "changed note\n", "note number 2\n")
+	if requests := e.server.Requests("GET", "/api2/data"); requests != 1 {
+		t.Errorf("Expected only the changed note to be fetched, got %d note requests", requests)
+	}
+	e.mustRun("search", "note")
+	if requests := e.server.Requests("GET", "/api2/data"); requests != 1 {
+		t.Errorf("Expected search to use cached notes, got %d note requests", requests)
+	}
+}
+
+func TestListStopsEarly(t *testing.T) {
+	e := newTestEnv(t)
+	for i := 0; i < 2*defaultNoteAmount+50; i++ {
+		e.server.Add(fmt.Sprintf("note number %d", i))
+	}
+	out := e.mustRun("list", "-n", "2")
+	assertContains(t, out, "Showing 2 notes.", "note number 249\n", "note number 248\n")
+	assertNotContains(t, out, "note number 247\n")
+	if requests := e.server.Requests("GET", "/api2/index"); requests != 1 {
+		t.Errorf("Expected single index page to be requested, got %d", requests)
+	}
+}
+
+func TestListSince(t *testing.T) {
+	e := newTestEnv(t)
+	e.server.Add("old note")
+	assertContains(t, e.mustRun("list", "--since", "2000-01-01"), "Showing 1 notes.")
+	assertContains(t, e.mustRun("list", "--since", "2100-01-01"), "Showing 0 notes.")
+	if _, err := e.run("list", "--since", "yesterday"); err == nil {
+		t.Error("Expected invalid --since value to be rejected")
+	}
+	for age, d := range map[string]time.Duration{"30m": 30 * time.Minute, "36h": 36 * time.Hour} {
+		since, err := ParseSince(age)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := time.Since(time.Unix(GetSimpleNoteTimestamp(since), 0)) - d; diff < -time.Second || diff > time.Minute {
+			t.Errorf("Expected --since %s to mean %s ago, got %s more", age, d, diff)
+		}
+	}
+}
+
+func TestListOutputFormats(t *testing.T) {
+	e := newTestEnv(t)
+	key := e.server.Add("structured note", "work")
+
+	notes := Notes{}
+	if err := json.Unmarshal([]byte(e.mustRun("list", "--output", "json")), &notes); err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 1 || notes[0].Key != key || notes[0].Content != "structured note" {
+		t.Errorf("Unexpected JSON output: %+v", notes)
+	}
+	assertContains(t, e.mustRun("list", "--output", "csv"), "key,createdate,modifydate,tags,systemtags,deleted,version,minversion,syncnum,sharekey,publishkey,content\n", key)
+	assertContains(t, e.mustRun("list", "--output", "ndjson"), `"key":"`+key+`"`)
+	assertContains(t, e.mustRun("list", "--output", "yaml"), "- key: \""+key+"\"", "  syncnum: 1\n")
+	if out := e.mustRun("list", "--output", "plain"); out != key+"\nstructured note\n\n" {
+		t.Errorf("Unexpected plain output: %q", out)
+	}
+	if out := e.mustRun("list", "--format", "{{.Key}} {{tags .Tags}}"); out != key+" @work\n" {
+		t.Errorf("Unexpected template output: %q", out)
+	}
+	if _, err := e.run("list", "--output", "xml"); err == nil {
+		t.Error("Expected unknown output format to be rejected")
+	}
+}
+
+func TestListWithSlowNotes(t *testing.T) {
+	e := newTestEnv(t)
+	e.server.OmitContent()
+	e.timeout = 200 * time.Millisecond
+	e.server.Add("fast note")
+	slow := e.server.Add("slow note")
+	e.server.Fail(fakeFailure{Path: "/api2/data/" + slow, Delay: time.Second, Times: -1})
+
+	out := e.mustRun("list")
+	assertContains(t, out, "Showing 1 notes.", "fast note")
+	assertContains(t, e.stderr, "could not fetch 1 of 2 notes", slow)
+}
+
+func TestGetNote(t *testing.T) {
+	e := newTestEnv(t)
+	key := e.server.Add("Note to get\nwith second line", "work")
+	assertContains(t, e.mustRun("get", key), key, "Note to get\nwith second line", "@work")
+	assertContains(t, e.mustRun("get", key[:6]), "Note to get")
+	if _, err := e.run("get", "0000000000"); err == nil {
+		t.Error("Expected unknown key prefix to be rejected")
+	}
+}
+
+func TestKeyPrefixResolvedLocally(t *testing.T) {
+	e := newTestEnv(t)
+	indexed := e.server.Add("Indexed note")
+	e.mustRun("list")
+	created := e.server.Add("Created elsewhere")
+	requests := e.server.Requests("GET", "/api2/index")
+	assertContains(t, e.mustRun("get", indexed[:6]), "Indexed note")
+	if e.server.Requests("GET", "/api2/index") != requests {
+		t.Error("Expected indexed key prefix to be resolved without listing notes")
+	}
+	assertContains(t, e.mustRun("get", created[:6]), "Created elsewhere")
+}
+
+func TestGetNoteOffline(t *testing.T) {
+	e := newTestEnv(t)
+	key := e.server.Add("Cached note")
+	e.mustRun("get", key)
+	e.server.Close()
+	assertContains(t, e.mustRun("get", key), "Cached note")
+	assertContains(t, e.stderr, "Network unavailable")
+	assertContains(t, e.mustRun("list"), "Cached note")
+}
+
+func TestOfflineNoticeShownOnce(t *testing.T) {
+	e := newTestEnv(t)
+	keys := []string{e.server.Add("First note"), e.server.Add("Second note")}
+	for _, key := range keys {
+		e.mustRun("get", key)
+	}
+	e.server.Close()
+	client := e.client(&CommandLineParams{Flags: make(map[string]string)})
+	var stderr bytes.Buffer
+	client.Stderr = &stderr
+	// Entries without modification date are never fresh, so every note is asked for.
+	notes, err := client.fetchNotes(Notes{{Key: keys[0]}, {Key: keys[1]}})
+	if err != nil || len(notes) != 2 {
+		t.Fatalf("Expected cached notes, got %+v, %v", notes, err)
+	}
+	if count := strings.Count(stderr.String(), "Network unavailable"); count != 1 {
+		t.Errorf("Expected offline notice once, got %d times:\n%s", count, stderr.String())
+	}
+}
+
+func TestCacheErrors(t *testing.T) {
+	e := newTestEnv(t)
+	key := e.server.Add("Some note")
+	// Regular file in place of cache directory makes every write fail.
+	if err := ioutil.WriteFile(e.cfg.CacheDir, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, e.mustRun("get", key), "Some note")
+	assertContains(t, e.stderr, "Could not cache notes")
+	e.editor(`echo "Changed" > "$1"`)
+	if _, err := e.run("edit", key); err == nil || !strings.Contains(err.Error(), e.cfg.CacheDir) {
+		t.Errorf("Expected failure to cache edited note to be reported, got %v", err)
+	}
+	if n, _ := e.server.Note(key); n.Content != "Changed" {
+		t.Errorf("Expected note to be updated anyway, got %q", n.Content)
+	}
+}
+
+func TestListOffline(t *testing.T) {
+	e := newTestEnv(t)
+	e.server.Add("Work plans", "work")
+	e.server.Add("Home chores", "home")
+	trashed := e.server.Add("Old work plans", "work")
+	e.mustRun("delete", trashed)
+	e.mustRun("list", "--deleted")
+	e.server.Close()
+
+	out := e.mustRun("list", "@work")
+	assertContains(t, e.stderr, "Network unavailable")
+	assertContains(t, out, "Showing 1 notes.", "Work plans")
+	assertNotContains(t, out, "Home chores", "Old work plans")
+	assertContains(t, e.mustRun("list", "--deleted", "@work"), "Showing 2 notes.", "Old work plans")
+	assertContains(t, e.mustRun("list", "--since", "2100-01-01"), "Showing 0 notes.")
+}
+
+func TestAliasNote(t *testing.T) {
+	e := newTestEnv(t)
+	key := e.server.Add("Groceries")
+	e.mustRun("list")
+	assertContains(t, e.mustRun("get", "1"), "Groceries")
+	assertContains(t, e.mustRun("alias", key, "shop"), "can now be referenced as shop")
+	assertContains(t, e.mustRun("get", "shop"), "Groceries")
+	assertContains(t, e.mustRun("alias", key), "1\nshop")
+	if _, err := e.run("alias", key, "42"); err == nil {
+		t.Error("Expected numeric alias to be rejected")
+	}
+}
+
+func TestPickNote(t *testing.T) {
+	e := newTestEnv(t)
+	e.server.Add("Holiday plans")
+	e.server.Add("Meeting notes")
+	e.cfg.Picker = "grep Meeting"
+	assertContains(t, e.mustRun("get"), "Meeting notes")
+	e.cfg.Picker = "false"
+	out := e.mustRun("get")
+	if out != "" {
+		t.Errorf("Expected cancelled choice to show nothing, got:\n%s", out)
+	}
+}
+
+func TestEditNote(t *testing.T) {
+	e := newTestEnv(t)
+	key := e.server.Add("Draft")
+	e.editor(`echo "Final version" > "$1"`)
+	assertContains(t, e.mustRun("edit", key), "Note updated.")
+	if n, _ := e.server.Note(key); n.Content != "Final version" {
+		t.Errorf("Unexpected note content: %q", n.Content)
+	}
+}
+
+func TestEditMergesConcurrentChange(t *testing.T) {
+	e := newTestEnv(t)
+	key := e.server.Add("line one\nline two\nline three")
+	edited := filepath.Join(e.dir, "edited")
+	resume := filepath.Join(e.dir, "resume")
+	// Editor changes the first line, then waits for the note to be changed elsewhere.
+	e.editor(fmt.Sprintf(`sed -i.bak 's/line one/line ONE/' "$1"; touch %s; while [ ! -f %s ]; do sleep 0.01; done`, edited, resume))
+	go func() {
+		for {
+			if _, err := os.Stat(edited); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		e.server.Change(key, "line one\nline two\nline THREE")
+		ioutil.WriteFile(resume, nil, 0600)
+	}()
+	assertContains(t, e.mustRun("edit", key), "changes merged", "Note updated.")
+	if n, _ := e.server.Note(key); n.Content != "line ONE\nline two\nline THREE" {
+		t.Errorf("Unexpected merged content: %q", n.Content)
+	}
+}
+
+func TestDeleteNote(t *testing.T) {
+	e := newTestEnv(t)
+	key := e.server.Add("To be deleted")
+	e.mustRun("delete", key)
+	if n, ok := e.server.Note(key); !ok || n.Deleted != 1 {
+		t.Fatalf("Expected note to be moved to trash, got %+v", n)
+	}
+	e.mustRun("delete", key, "--permanently")
+	if _, ok := e.server.Note(key); ok {
+		t.Fatal("Expected note to be deleted permanently")
+	}
+}
+
+func TestHistoryShowRestore(t *testing.T) {
+	e := newTestEnv(t)
+	key := e.server.Add("First draft")
+	e.server.Change(key, "Second draft")
+	e.server.Change(key, "Third draft")
+
+	out := e.mustRun("history", key)
+	assertContains(t, out, "Showing 3 versions", "Version 3", "Third draft", "Version 1", "First draft")
+	assertContains(t, e.mustRun("show", key, "--version", "1"), "First draft")
+	assertContains(t, e.mustRun("show", key), "Third draft")
+
+	assertContains(t, e.mustRun("restore", key, "1"), "Note restored to version 1.")
+	if n, _ := e.server.Note(key); n.Content != "First draft" || n.Version != 4 {
+		t.Errorf("Unexpected restored note: %+v", n)
+	}
+	if _, err := e.run("restore", key); err == nil {
+		t.Error("Expected missing version to be rejected")
+	}
+
+	e.server.Add("Other note")
+	e.cfg.Picker = "grep draft"
+	assertContains(t, e.mustRun("restore", "2"), "Note restored to version 2.")
+	if n, _ := e.server.Note(key); n.Content != "Second draft" || n.Version != 5 {
+		t.Errorf("Unexpected note restored without key: %+v", n)
+	}
+}
+
+func TestSearchNotes(t *testing.T) {
+	e := newTestEnv(t)
+	e.server.Add("Buy milk and eggs", "home")
+	e.server.Add("Milk the cows", "farm")
+	e.server.Add("Call the bank")
+
+	out := e.mustRun("search", "milk")
+	assertContains(t, out, "Found 2 notes", "Buy milk", "Milk the cows")
+	assertNotContains(t, out, "Call the bank")
+
+	out = e.mustRun("search", "milk", "AND", "NOT", "eggs")
+	assertContains(t, out, "Found 1 notes", "Milk the cows")
+
+	assertContains(t, e.mustRun("search", "@home", "milk"), "Found 1 notes", "Buy milk")
+}
+
+func TestTUIRequiresTerminal(t *testing.T) {
+	e := newTestEnv(t)
+	e.server.Add("Some note")
+	if _, err := e.run("tui"); !errors.Is(err, errNoTerminal) {
+		t.Errorf("Expected %q error, got %v", errNoTerminal, err)
+	}
+}
+
+func TestTUIBrowser(t *testing.T) {
+	e := newTestEnv(t)
+	older := e.server.Add("Older note")
+	newer := e.server.Add("Newer note")
+	e.mustRun("get", older)
+	e.mustRun("get", newer)
+	client := e.client(&CommandLineParams{Flags: make(map[string]string)})
+	var stderr bytes.Buffer
+	client.Stderr = &stderr
+	notes := Notes{}
+	for _, key := range []string{older, newer} {
+		n, err := client.fetchNote(&Note{Key: key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		notes = append(notes, n)
+	}
+	b := &noteBrowser{client: client, notes: notes}
+	b.refresh()
+	if len(b.visible) != 2 || b.visible[0].Key != newer {
+		t.Fatalf("Expected newest note first, got %+v", b.visible)
+	}
+
+	// Changed note is reloaded from the cache when server can't be reached.
+	e.server.Close()
+	b.finish(older, nil, "Done.")
+	if b.status != "Done." {
+		t.Errorf("Expected note to be reloaded offline, got status %q", b.status)
+	}
+	assertContains(t, stderr.String(), "Network unavailable")
+}
+
+func TestOfflineWritesAreSynced(t *testing.T) {
+	e := newTestEnv(t)
+	e.timeout = 200 * time.Millisecond
+	key := e.server.Add("Existing note")
+	e.server.Fail(fakeFailure{Path: "/api2/data", Delay: time.Second, Times: 2})
+
+	out, err := e.runWithInput("Written offline\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, e.stderr, "change queued")
+	assertContains(t, out, queuedNoteLabel+"\n")
+	e.mustRun("delete", key)
+	// Delayed requests are still handled after client gives up, note gets created without us knowing.
+	time.Sleep(time.Second)
+	if e.server.Count() != 2 {
+		t.Fatalf("Expected timed out request to create the note, got %d notes", e.server.Count())
+	}
+
+	assertContains(t, e.mustRun("sync"), "Synced 2 changes.")
+	if e.server.Count() != 2 {
+		t.Fatalf("Expected queued note to be created once, got %d notes", e.server.Count())
+	}
+	if n, _ := e.server.Note(key); n.Deleted != 1 {
+		t.Error("Expected queued delete to be sent")
+	}
+	c := e.client(&CommandLineParams{})
+	created := ""
+	for _, n := range c.Index.All() {
+		if n.Key != key {
+			created = n.Key
+		}
+	}
+	if n, ok := c.Cache.Get(created); !ok || strings.TrimSpace(n.Content) != "Written offline" {
+		t.Error("Expected synced note to be cached")
+	}
+	if len(c.Aliases.For(created)) == 0 {
+		t.Error("Expected synced note to get a handle")
+	}
+	assertContains(t, e.mustRun("sync"), "Synced 0 changes.")
+
+	// Note purged before queued delete was replayed.
+	e.server.Fail(fakeFailure{Path: "/api2/data", Status: 503, Delay: time.Second, Times: -1})
+	e.mustRun("delete", "--permanently", created)
+	e.server.Recover()
+	e.mustRun("delete", "--permanently", created)
+	assertContains(t, e.mustRun("sync"), "Synced 1 changes.")
+}
+
+func TestOfflineEditsAreMerged(t *testing.T) {
+	e := newTestEnv(t)
+	e.timeout = 200 * time.Millisecond
+	key := e.server.Add("line one\nline two\nline three")
+	e.mustRun("get", key)
+	edit := func(script string) {
+		e.server.Fail(fakeFailure{Path: "/api2/data", Status: 503, Delay: time.Second, Times: -1})
+		e.editor(script)
+		e.mustRun("edit", key)
+		assertContains(t, e.stderr, "change queued")
+		e.server.Recover()
+	}
+
+	edit(`sed -i.bak 's/line one/line ONE/' "$1"`)
+	e.server.Change(key, "line one\nline two\nline THREE")
+	assertContains(t, e.mustRun("sync"), "Synced 1 changes.")
+	if n, _ := e.server.Note(key); n.Content != "line ONE\nline two\nline THREE" {
+		t.Errorf("Expected queued update to be merged, got %q", n.Content)
+	}
+
+	e.mustRun("get", key)
+	edit(`sed -i.bak 's/line two/line 2 here/' "$1"`)
+	e.server.Change(key, "line ONE\nline 2 there\nline THREE")
+	assertContains(t, e.mustRun("sync"), "Synced 1 changes.")
+	assertContains(t, e.stderr, "resolve conflicts with `gonote edit "+key+"`")
+	n, _ := e.server.Note(key)
+	assertContains(t, n.Content, conflictLocalMarker+"\nline 2 here\n"+conflictSeparator+"\nline 2 there\n"+conflictRemoteMarker)
+}
+
+func TestTokenIsReused(t *testing.T) {
+	e := newTestEnv(t)
+	e.server.Add("Note")
+	e.mustRun("list")
+	e.mustRun("list")
+	if e.server.logins != 1 {
+		t.Errorf("Expected single login, got %d", e.server.logins)
+	}
+
+	e.server.ExpireToken()
+	assertContains(t, e.mustRun("list"), "Showing 1 notes.")
+	if e.server.logins != 2 {
+		t.Errorf("Expected new login after token was rejected, got %d logins", e.server.logins)
+	}
+
+	assertContains(t, e.mustRun("logout"), "Logged out.")
+	if _, err := os.Stat(filepath.Join(e.dir, "token.json")); !os.IsNotExist(err) {
+		t.Error("Expected saved token to be removed")
+	}
+	e.mustRun("list")
+	if e.server.logins != 3 {
+		t.Errorf("Expected login after logout, got %d logins", e.server.logins)
+	}
+}
+
+func TestInvalidCredentials(t *testing.T) {
+	e := newTestEnv(t)
+	e.creds = plainCredentials("wrong")
+	_, err := e.run("list")
+	if err == nil || !strings.Contains(err.Error(), "Error authorizing") {
+		t.Errorf("Expected authorization error, got %v", err)
+	}
+	if requests := e.server.Requests("POST", "/api/login"); requests != 1 {
+		t.Errorf("Expected single login attempt, got %d", requests)
+	}
+}
+
+func TestCredentialsFile(t *testing.T) {
+	t.Setenv(passphraseEnv, "passphrase")
+	creds := &fileCredentials{Path: filepath.Join(t.TempDir(), "credentials.json")}
+	if err := creds.Save(fakeEmail, "secret password", "passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if password, err := creds.Password(fakeEmail); err != nil || password != "secret password" {
+		t.Errorf("Unexpected password %q: %v", password, err)
+	}
+	t.Setenv(passphraseEnv, "wrong")
+	if _, err := creds.Password(fakeEmail); err == nil {
+		t.Error("Expected wrong passphrase to be rejected")
+	}
+
+	t.Setenv(passphraseEnv, "passphrase")
+	if err := ioutil.WriteFile(creds.Path, []byte(`{"rounds": 200000, "salt": "c2FsdA==", "nonce": "bm9uY2U=", "data": "ZGF0YQ=="}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := creds.Password(fakeEmail); err == nil || !strings.Contains(err.Error(), "Unknown key derivation function") {
+		t.Errorf("Expected file without key derivation function to be rejected, got %v", err)
+	}
+}
+
+func TestRetryServerErrors(t *testing.T) {
+	e := newTestEnv(t)
+	key := e.server.Add("Note")
+	e.server.Fail(fakeFailure{Path: "/api2/index", Status: 500, Times: 2})
+	assertContains(t, e.mustRun("list"), "Showing 1 notes.")
+	if requests := e.server.Requests("GET", "/api2/index"); requests != 3 {
+		t.Errorf("Expected index to be requested 3 times, got %d", requests)
+	}
+
+	e.server.Fail(fakeFailure{Method: "POST", Path: "/api2/data/" + key, Status: 412, Times: 1})
+	e.editor(`echo "Changed" > "$1"`)
+	e.mustRun("edit", key)
+	if n, _ := e.server.Note(key); n.Content != "Changed" {
+		t.Errorf("Expected update to be retried, got %q", n.Content)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	e := newTestEnv(t)
+	e.server.Add("Note")
+	e.server.Fail(fakeFailure{Path: "/api2/index", Status: 503, Times: -1})
+	if _, err := e.run("list"); err == nil {
+		t.Fatal("Expected list to fail")
+	}
+	if requests := e.server.Requests("GET", "/api2/index"); requests != simplenote.DefaultMaxAttempts {
+		t.Errorf("Expected %d attempts, got %d", simplenote.DefaultMaxAttempts, requests)
+	}
+}
+
+func TestErrorExitCodes(t *testing.T) {
+	e := newTestEnv(t)
+	key := e.server.Add("Note")
+	missing := strings.Repeat("0", SimpleNoteKeyLength)
+
+	_, err := e.run("get", missing)
+	if code := exitCode(err); code != exitNotFound {
+		t.Errorf("Expected exit code %d for missing note, got %d (%v)", exitNotFound, code, err)
+	}
+	assertContains(t, errorMessage(err), "Note does not exist.")
+	if _, err = e.run("get", "zzzzzz"); exitCode(err) != exitNotFound {
+		t.Errorf("Expected unknown key prefix to exit with %d, got %v", exitNotFound, err)
+	}
+
+	e.server.Fail(fakeFailure{Path: "/api2/data/" + key, Status: 429, Times: -1})
+	if _, err = e.run("get", key); exitCode(err) != exitRateLimited {
+		t.Errorf("Expected exit code %d when rate limited, got %v", exitRateLimited, err)
+	}
+
+	e.server.Close()
+	if _, err = e.run("get", missing); exitCode(err) != exitNetwork {
+		t.Errorf("Expected exit code %d when offline, got %v", exitNetwork, err)
+	}
+
+	e = newTestEnv(t)
+	e.creds = plainCredentials("wrong")
+	_, err = e.run("list")
+	if exitCode(err) != exitUnauthorized {
+		t.Errorf("Expected exit code %d for rejected credentials, got %v", exitUnauthorized, err)
+	}
+	assertContains(t, errorMessage(err), "Error authorizing")
+}
+
+func TestCompletion(t *testing.T) {
+	e := newTestEnv(t)
+	key := e.server.Add("Shopping list\nmilk", "home")
+	e.server.Add("Work plans", "work")
+	e.mustRun("list")
+	e.mustRun("alias", key, "shop")
+	e.server.Close() // Completion must only use local data
+
+	client := e.client(nil)
+	c := &completer{
+		Config:  &mainConfig{Path: filepath.Join(e.dir, "gonote.json"), File: e.cfg, UserCfg: e.cfg},
+		Index:   client.Index,
+		Aliases: client.Aliases,
+	}
+	completions := func(words ...string) string {
+		return capture(t, &os.Stdout, func() {
+			c.Complete(os.Stdout, words)
+		})
+	}
+	assertContains(t, completions("li"), "list\tList notes")
+	assertContains(t, completions("get", ""), key+"\tShopping list\n", "shop\tShopping list\n", "\tWork plans\n")
+	if out := completions("edit", key[:6]); out != key+"\tShopping list\n" {
+		t.Errorf("Expected single key to be completed, got %q", out)
+	}
+	if out := completions("list", "@"); out != "@home\n@work\n" {
+		t.Errorf("Expected tags to be completed, got %q", out)
+	}
+	assertContains(t, completions("list", "--out"), "--output\t")
+	assertContains(t, completions("get", "--output", "nd"), "ndjson")
+	if out := completions("--", "li"); out != "" {
+		t.Errorf("Expected nothing to be completed after --, got %q", out)
+	}
+
+	assertContains(t, e.mustRun("completion", "bash"), "complete -F _gonote gonote")
+	if _, err := e.run("completion", "tcsh"); err == nil {
+		t.Error("Expected unsupported shell to be rejected")
+	}
+}
+
+func TestBashCompletionScript(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not installed")
+	}
+	// Stub of gonote prints words it was called with, and offers the last of them back.
+	script := completionScripts["bash"] + `
+gonote() {
+	shift
+	printf '%s|' "$@" > "$WORDS"
+	printf '%s\tdescription\n' "${@: -1}"
+}
+COMP_POINT=${#COMP_LINE}
+_gonote
+printf '%d:' ${#COMPREPLY[@]}
+printf '%s|' "${COMPREPLY[@]}"
+`
+	words := filepath.Join(t.TempDir(), "words")
+	for _, c := range []struct {
+		line, words, replies string
+	}{
+		{"gonote list @wo", "list|@wo|", "1:wo|"},
+		{"gonote get ", "get||", "0:|"},
+		{"gonote  --profile=wo", "--profile=wo|", "1:wo|"},
+		{"gonote restore abc 2", "restore|abc|2|", "1:2|"},
+	} {
+		cmd := exec.Command(bash, "--norc", "-c", script)
+		cmd.Env = append(os.Environ(), "COMP_LINE="+c.line, "WORDS="+words)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %s", err, out)
+		}
+		passed, _ := ioutil.ReadFile(words)
+		if string(passed) != c.words || string(out) != c.replies {
+			t.Errorf("Completing %q: expected words %q and replies %q, got %q and %q", c.line, c.words, c.replies, passed, out)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/exaroth/gonote/v2/simplenote"
+	"net/url"
+	"time"
+)
+
+const (
+	simpleNoteBackend = "simplenote"
+	localBackend      = "local"
+)
+
+// NoteStore represents storage backend holding user notes.
+// Client talks only to this interface, so notes can be kept anywhere.
+// Index has to list notes most recently modified first across all the pages,
+// listing relies on it to show newest notes without reading the whole index.
+type NoteStore interface {
+	Authorize() error
+	Logout() error
+	Create(n *Note) (*Note, error)
+	Fetch(key string) (*Note, error)
+	FetchVersion(key string, version int) (*Note, error)
+	Update(n *Note) error
+	Trash(key string) error
+	Purge(key string) error
+	Index(mark string, length int, opts IndexOptions) (*NoteList, error)
+}
+
+// newNoteStore returns note store for the backend set in user configuration.
+// Requests to remote stores are cancelled together with the context.
+func newNoteStore(ctx context.Context, config MainConfig, opts ...simplenote.Option) (NoteStore, error) {
+	cfg := config.GetUserConfig()
+	switch cfg.Backend {
+	case "", simpleNoteBackend:
+		creds, err := newCredentialProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return newSimpleNoteStore(ctx, config, creds, opts...), nil
+	case localBackend:
+		return newLocalStore(ExpandPath(cfg.NotesDir)), nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unknown note backend: %s", cfg.Backend))
+}
+
+// IsNetworkError reports whether request failed before receiving any response from the server.
+// Requests cancelled by the user are not network errors, so nothing gets queued for later.
+func IsNetworkError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// simpleNoteStore is NoteStore implementation backed by SimpleNote HTTP API.
+type simpleNoteStore struct {
+	Ctx         context.Context // Cancelled when user interrupts the program
+	API         *simplenote.Client
+	Cfg         *UserConfigFile
+	Credentials CredentialProvider
+	Tokens      *tokenCache
+}
+
+// newSimpleNoteStore returns store communicating with SimpleNote servers.
+// Options override API client settings taken from user configuration.
+func newSimpleNoteStore(ctx context.Context, config MainConfig, creds CredentialProvider, opts ...simplenote.Option) NoteStore {
+	cfg := config.GetUserConfig()
+	defaults := []simplenote.Option{simplenote.WithUserAgent(fmt.Sprintf("GoNote/%s", Version))}
+	if cfg.RequestTimeout > 0 {
+		defaults = append(defaults, simplenote.WithTimeout(time.Duration(cfg.RequestTimeout)*time.Second))
+	}
+	return &simpleNoteStore{
+		Ctx:         ctx,
+		API:         simplenote.NewClient(cfg.Email, append(defaults, opts...)...),
+		Cfg:         cfg,
+		Credentials: creds,
+		Tokens:      newTokenCache(ExpandPath(cfg.dataPath(defaultTokenPath))),
+	}
+}
+
+// Create saves new note in SimpleNote.
+func (s *simpleNoteStore) Create(n *Note) (newNote *Note, err error) {
+	err = s.call(func() (err error) {
+		newNote, err = s.API.Create(s.context(), n)
+		return
+	})
+	return
+}
+
+// Fetch retrieves single note contents.
+func (s *simpleNoteStore) Fetch(key string) (n *Note, err error) {
+	err = s.call(func() (err error) {
+		n, err = s.API.Get(s.context(), key)
+		return
+	})
+	return
+}
+
+// FetchVersion retrieves note contents as they were in given version.
+func (s *simpleNoteStore) FetchVersion(key string, version int) (n *Note, err error) {
+	err = s.call(func() (err error) {
+		n, err = s.API.GetVersion(s.context(), key, version)
+		return
+	})
+	return
+}
+
+// Update updates all available values for given note.
+func (s *simpleNoteStore) Update(n *Note) error {
+	return s.call(func() (err error) {
+		_, err = s.API.Update(s.context(), n)
+		return
+	})
+}
+
+// Trash moves the note with given key to trash.
+func (s *simpleNoteStore) Trash(key string) error {
+	return s.call(func() error {
+		return s.API.Trash(s.context(), key)
+	})
+}
+
+// Purge permanently deletes the note, SimpleNote requires it to be in trash first.
+func (s *simpleNoteStore) Purge(key string) error {
+	return s.call(func() error {
+		return s.API.Delete(s.context(), key)
+	})
+}
+
+// Index retrieves single page of the note list, starting at given mark.
+func (s *simpleNoteStore) Index(mark string, length int, opts IndexOptions) (l *NoteList, err error) {
+	err = s.call(func() (err error) {
+		l, err = s.API.Index(s.context(), simplenote.IndexOptions{
+			Mark:    mark,
+			Length:  length,
+			Content: opts.Content,
+			Since:   opts.Since,
+		})
+		return
+	})
+	return
+}
+
+// Authorize retrieves access token used for calling SimpleNote servers,
+// reusing one saved by previous run if it did not expire.
+func (s *simpleNoteStore) Authorize() (err error) {
+	if token, ok := s.Tokens.Get(s.Cfg.Email); ok {
+		s.API.SetToken(token)
+		return
+	}
+	return s.login()
+}
+
+// Logout forgets saved access token.
+func (s *simpleNoteStore) Logout() error {
+	s.API.SetToken("")
+	return s.Tokens.Clear()
+}
+
+// login exchanges user credentials for new access token.
+func (s *simpleNoteStore) login() (err error) {
+	password, err := s.Credentials.Password(s.Cfg.Email)
+	if err != nil {
+		return
+	}
+	err = s.API.Login(s.context(), password)
+	var apiErr *simplenote.APIError
+	if errors.As(err, &apiErr) {
+		return fmt.Errorf("Error authorizing the client, check if username or password are valid. Status code was : %d: %w", apiErr.Status, simplenote.ErrUnauthorized)
+	} else if err != nil {
+		return
+	}
+	return s.Tokens.Put(s.Cfg.Email, s.API.Token())
+}
+
+// call runs API request, logging in again once if saved token was rejected.
+func (s *simpleNoteStore) call(request func() error) error {
+	err := request()
+	if errors.Is(err, simplenote.ErrUnauthorized) {
+		if err = s.login(); err != nil {
+			return err
+		}
+		return request()
+	}
+	return err
+}
+
+// context returns context requests are bound to.
+func (s *simpleNoteStore) context() context.Context {
+	if s.Ctx == nil {
+		return context.Background()
+	}
+	return s.Ctx
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// errNoTerminal is returned when interactive mode is requested without terminal attached.
+var errNoTerminal = errors.New("Interactive mode requires terminal.")
+
+// terminal represents user terminal switched into raw mode, where every key press
+// is delivered immediately without being echoed.
+type terminal struct {
+	in      *os.File
+	restore func() error
+}
+
+// openTerminal switches standard input into raw mode.
+func openTerminal() (*terminal, error) {
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	return &terminal{in: os.Stdin, restore: restore}, nil
+}
+
+// Size returns number of columns and rows of the terminal.
+func (t *terminal) Size() (int, int, error) {
+	return terminalSize(int(t.in.Fd()))
+}
+
+// ReadKey waits for single key press, returning its raw bytes.
+func (t *terminal) ReadKey() (string, error) {
+	buf := make([]byte, 16)
+	n, err := t.in.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
+
+// Suspend restores original terminal mode, e.g. before running external editor.
+// Raw mode is enabled again by calling Resume.
+func (t *terminal) Suspend() error {
+	return t.restore()
+}
+
+// Resume switches terminal back into raw mode after Suspend.
+func (t *terminal) Resume() (err error) {
+	t.restore, err = makeRaw(int(t.in.Fd()))
+	return
+}
+
+// Close restores original terminal mode.
+func (t *terminal) Close() error {
+	return t.restore()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultTokenPath = "~/.gonote/token.json"
+	tokenLifetime    = 24 * time.Hour // SimpleNote does not tell when token expires, assume it is valid for a day
+)
+
+// authToken represents SimpleNote access token saved between runs.
+type authToken struct {
+	Email   string    `json:"email"`
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// tokenCache keeps access token on disk, so user does not have to log in on every run.
+// File is locked while used, as several gonote instances may be running at once.
+// All the methods are safe to call on nil cache.
+type tokenCache struct {
+	Path string
+}
+
+// newTokenCache returns token cache saved in given file.
+func newTokenCache(path string) *tokenCache {
+	return &tokenCache{Path: path}
+}
+
+// Get returns saved token of given user, if it did not expire yet.
+func (t *tokenCache) Get(email string) (token string, ok bool) {
+	if t == nil {
+		return "", false
+	}
+	t.locked(func() error {
+		data, err := ioutil.ReadFile(t.Path)
+		if err != nil {
+			return err
+		}
+		saved := &authToken{}
+		if err = json.Unmarshal(data, saved); err != nil {
+			return err
+		}
+		if saved.Email == email && saved.Token != "" && time.Now().Before(saved.Expires) {
+			token, ok = saved.Token, true
+		}
+		return nil
+	})
+	return
+}
+
+// Put saves token of given user, replacing previous one.
+func (t *tokenCache) Put(email, token string) error {
+	if t == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(t.Path), 0700); err != nil {
+		return err
+	}
+	return t.locked(func() error {
+		data, err := json.MarshalIndent(&authToken{
+			Email:   email,
+			Token:   token,
+			Expires: time.Now().Add(tokenLifetime),
+		}, "", "\t")
+		if err != nil {
+			return err
+		}
+		tmp := t.Path + ".tmp"
+		if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+			return err
+		}
+		return os.Rename(tmp, t.Path)
+	})
+}
+
+// Clear removes saved token.
+func (t *tokenCache) Clear() error {
+	if t == nil {
+		return nil
+	}
+	return t.locked(func() error {
+		if err := os.Remove(t.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+// locked runs the function holding exclusive lock of the cache file.
+func (t *tokenCache) locked(f func() error) error {
+	lock, err := os.OpenFile(t.Path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Directory does not exist, so there is nothing to guard.
+			return f()
+		}
+		return err
+	}
+	defer lock.Close()
+	if err = lockFile(lock); err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+	return f()
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	pinnedSystemTag = "pinned"
+	listPaneRatio   = 0.4 // Part of the screen width taken by note list
+
+	keyUp        = "\x1b[A"
+	keyDown      = "\x1b[B"
+	keyPageUp    = "\x1b[5~"
+	keyPageDown  = "\x1b[6~"
+	keyEscape    = "\x1b"
+	keyEnter     = "\r"
+	keyBackspace = "\x7f"
+	keyCtrlC     = "\x03"
+
+	ansiAltScreen  = "\x1b[?1049h\x1b[?25l"
+	ansiMainScreen = "\x1b[?25h\x1b[?1049l"
+	ansiClear      = "\x1b[H\x1b[2J"
+	ansiReverse    = "\x1b[7m"
+	ansiReset      = "\x1b[0m"
+
+	tuiHelp       = "j/k move  / filter  t tag  e edit  d trash  r restore  p pin  x trash view  q quit"
+	tuiFilterHelp = "Type to filter, Enter or Esc to finish"
+)
+
+// noteBrowser is full-screen terminal UI for browsing and managing notes.
+type noteBrowser struct {
+	client    *simpleNoteClient
+	term      *terminal
+	notes     Notes // All loaded notes, including trashed ones
+	visible   Notes // Notes matching current filters
+	tags      []string
+	tag       int // Index of selected tag facet, 0 meaning all tags
+	filter    string
+	filtering bool
+	trash     bool // Whether trashed notes are shown instead of regular ones
+	selected  int
+	offset    int
+	status    string
+}
+
+// BrowseNotes opens interactive note browser.
+func (s *simpleNoteClient) browseNotes() error {
+	s.Params.Flags["deleted"] = "true"
+	notes, err := s.getNotes()
+	if err != nil {
+		return err
+	}
+	term, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	b := &noteBrowser{client: s, term: term, notes: notes}
+	// Messages meant for command line would break the screen, status line reports results instead.
+	s.Stdout, s.Stderr = ioutil.Discard, ioutil.Discard
+	fmt.Print(ansiAltScreen)
+	defer func() {
+		fmt.Print(ansiMainScreen)
+		term.Close()
+	}()
+	b.refresh()
+	for {
+		if err = b.draw(); err != nil {
+			return err
+		}
+		key, err := term.ReadKey()
+		if err != nil {
+			return err
+		}
+		if quit := b.handleKey(key); quit {
+			return nil
+		}
+	}
+}
+
+// handleKey performs action bound to the key, returns true if browser should be closed.
+func (b *noteBrowser) handleKey(key string) bool {
+	b.status = ""
+	if b.filtering {
+		switch key {
+		case keyEnter, keyEscape:
+			b.filtering = false
+		case keyBackspace:
+			if r := []rune(b.filter); len(r) > 0 {
+				b.filter = string(r[:len(r)-1])
+			}
+		case keyCtrlC:
+			return true
+		default:
+			if !strings.HasPrefix(key, keyEscape) && key >= " " {
+				b.filter += key
+			}
+		}
+		b.refresh()
+		return false
+	}
+	_, rows, _ := b.term.Size()
+	switch key {
+	case "q", keyCtrlC:
+		return true
+	case "j", keyDown:
+		b.move(1)
+	case "k", keyUp:
+		b.move(-1)
+	case keyPageDown:
+		b.move(rows / 2)
+	case keyPageUp:
+		b.move(-rows / 2)
+	case "/":
+		b.filtering = true
+	case keyEscape:
+		b.filter = ""
+		b.refresh()
+	case "t":
+		b.tag = (b.tag + 1) % (len(b.tags) + 1)
+		b.refresh()
+	case "x":
+		b.trash = !b.trash
+		b.tag = 0
+		b.refresh()
+	case "e", keyEnter:
+		b.edit()
+	case "d":
+		b.update(func(n *Note) error {
+			b.client.Params.Flags["permanently"] = "false"
+			return b.client.deleteNote()
+		}, "Note moved to trash.")
+	case "r":
+		b.update(func(n *Note) error {
+			n.Deleted = 0
+			return b.client.updateNote(n)
+		}, "Note restored.")
+	case "p":
+		b.update(func(n *Note) error {
+			if CheckIn(pinnedSystemTag, n.SystemTags) {
+				n.SystemTags = removeString(n.SystemTags, pinnedSystemTag)
+			} else {
+				n.SystemTags = append(n.SystemTags, pinnedSystemTag)
+			}
+			return b.client.updateNote(n)
+		}, "Note pin toggled.")
+	}
+	return false
+}
+
+// current returns selected note.
+func (b *noteBrowser) current() *Note {
+	if b.selected < 0 || b.selected >= len(b.visible) {
+		return nil
+	}
+	return &b.visible[b.selected]
+}
+
+func (b *noteBrowser) move(delta int) {
+	b.selected += delta
+	if b.selected >= len(b.visible) {
+		b.selected = len(b.visible) - 1
+	}
+	if b.selected < 0 {
+		b.selected = 0
+	}
+}
+
+// edit opens selected note in external editor, using the same path as edit command.
+func (b *noteBrowser) edit() {
+	n := b.current()
+	if n == nil {
+		return
+	}
+	fmt.Print(ansiMainScreen)
+	b.term.Suspend()
+	b.client.Params.Key = n.Key
+	err := b.client.editNote()
+	b.term.Resume()
+	fmt.Print(ansiAltScreen)
+	b.finish(n.Key, err, "Note updated.")
+}
+
+// update runs action changing selected note, then reloads it.
+func (b *noteBrowser) update(action func(n *Note) error, done string) {
+	n := b.current()
+	if n == nil {
+		return
+	}
+	b.client.Params.Key = n.Key
+	note := *n
+	b.finish(n.Key, action(&note), done)
+}
+
+// finish reloads note after it was changed, reporting result in status line.
+// Cached copy is used when the note store can't be reached.
+func (b *noteBrowser) finish(key string, err error, done string) {
+	if err != nil {
+		b.status = err.Error()
+		return
+	}
+	updated, err := b.client.fetchNote(&Note{Key: key})
+	if err != nil {
+		b.status = err.Error()
+		return
+	}
+	for i := range b.notes {
+		if b.notes[i].Key == key {
+			b.notes[i] = updated
+		}
+	}
+	b.status = done
+	b.refresh()
+}
+
+// refresh recomputes visible notes and tag facets after filters or notes changed.
+func (b *noteBrowser) refresh() {
+	selectedKey := ""
+	if n := b.current(); n != nil {
+		selectedKey = n.Key
+	}
+	words := strings.Fields(strings.ToLower(b.filter))
+	counts := make(map[string]int)
+	inView := Notes{}
+	for _, n := range b.notes {
+		if (n.Deleted == 1) != b.trash {
+			continue
+		}
+		if !matchesWords(&n, words) {
+			continue
+		}
+		for _, t := range n.Tags {
+			counts[t]++
+		}
+		inView = append(inView, n)
+	}
+	selectedTag := ""
+	if b.tag > 0 && b.tag <= len(b.tags) {
+		selectedTag = b.tags[b.tag-1]
+	}
+	b.tags = make([]string, 0, len(counts))
+	for t := range counts {
+		b.tags = append(b.tags, t)
+	}
+	sort.Slice(b.tags, func(i, j int) bool {
+		if counts[b.tags[i]] != counts[b.tags[j]] {
+			return counts[b.tags[i]] > counts[b.tags[j]]
+		}
+		return b.tags[i] < b.tags[j]
+	})
+	b.tag = 0
+	for i, t := range b.tags {
+		if t == selectedTag {
+			b.tag = i + 1
+		}
+	}
+	b.visible = Notes{}
+	for _, n := range inView {
+		if b.tag == 0 || CheckIn(selectedTag, n.Tags) {
+			b.visible = append(b.visible, n)
+		}
+	}
+	sort.Sort(sort.Reverse(b.visible))
+	b.selected = 0
+	for i, n := range b.visible {
+		if n.Key == selectedKey {
+			b.selected = i
+		}
+	}
+	b.move(0)
+}
+
+// draw renders the whole screen.
+func (b *noteBrowser) draw() error {
+	cols, rows, err := b.term.Size()
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString(ansiClear)
+	title := fmt.Sprintf("GoNote - %d notes", len(b.visible))
+	if b.trash {
+		title += " in trash"
+	}
+	if b.filter != "" || b.filtering {
+		title += fmt.Sprintf("  filter: %s", b.filter)
+		if b.filtering {
+			title += "_"
+		}
+	}
+	writeLine(buf, title, cols)
+	facets := []string{"all"}
+	for _, t := range b.tags {
+		facets = append(facets, tagPrefix+t)
+	}
+	writeLine(buf, "Tags: "+b.renderFacets(facets, cols-6), cols)
+	writeLine(buf, strings.Repeat("-", cols), cols)
+
+	height := rows - 4
+	if height < 1 {
+		height = 1
+	}
+	if b.selected < b.offset {
+		b.offset = b.selected
+	} else if b.selected >= b.offset+height {
+		b.offset = b.selected - height + 1
+	}
+	listWidth := int(float64(cols) * listPaneRatio)
+	previewWidth := cols - listWidth - 3
+	preview := []string{}
+	if n := b.current(); n != nil {
+		preview = append(preview, redColored(n.Key), cyanColored(HumanDate(n.ModifyDate))+" "+blueColored(ParseTags(n.Tags)), "")
+		for _, l := range noteLines(n) {
+			preview = append(preview, wrapLine(l, previewWidth)...)
+		}
+	}
+	for i := 0; i < height; i++ {
+		left := ""
+		if idx := b.offset + i; idx < len(b.visible) {
+			n := &b.visible[idx]
+			marker := " "
+			if CheckIn(pinnedSystemTag, n.SystemTags) {
+				marker = "*"
+			}
+			left = fitWidth(marker+" "+noteHeader(n), listWidth)
+			if idx == b.selected {
+				left = ansiReverse + left + ansiReset
+			}
+		} else {
+			left = strings.Repeat(" ", listWidth)
+		}
+		right := ""
+		if i < len(preview) {
+			right = preview[i]
+		}
+		buf.WriteString(left + " | " + right + "\n")
+	}
+	footer := tuiHelp
+	if b.filtering {
+		footer = tuiFilterHelp
+	}
+	if b.status != "" {
+		footer = b.status
+	}
+	buf.WriteString(fitWidth(footer, cols))
+	_, err = os.Stdout.Write(buf.Bytes())
+	return err
+}
+
+// renderFacets joins tag facets fitting in given width, highlighting selected one.
+func (b *noteBrowser) renderFacets(facets []string, width int) string {
+	parts := []string{}
+	used := 0
+	for i, f := range facets {
+		used += len([]rune(f)) + 1
+		if used > width {
+			break
+		}
+		if i == b.tag {
+			f = ansiReverse + f + ansiReset
+		}
+		parts = append(parts, f)
+	}
+	return strings.Join(parts, " ")
+}
+
+// writeLine writes single screen line, cut to the screen width.
+func writeLine(buf *bytes.Buffer, line string, cols int) {
+	if !strings.Contains(line, "\x1b") {
+		line = fitWidth(line, cols)
+	}
+	buf.WriteString(line + "\n")
+}
+
+// fitWidth cuts or pads the text to exactly given number of characters.
+func fitWidth(s string, width int) string {
+	r := []rune(s)
+	if len(r) > width {
+		return string(r[:width])
+	}
+	return s + strings.Repeat(" ", width-len(r))
+}
+
+// wrapLine splits long line into ones fitting given width.
+func wrapLine(s string, width int) []string {
+	r := []rune(s)
+	if width < 1 || len(r) <= width {
+		return []string{s}
+	}
+	lines := []string{}
+	for len(r) > width {
+		lines = append(lines, string(r[:width]))
+		r = r[width:]
+	}
+	return append(lines, string(r))
+}
+
+// matchesWords checks if note content or tags contain all the words, which may be typed partially.
+func matchesWords(n *Note, words []string) bool {
+	text := strings.ToLower(n.Content + " " + strings.Join(n.Tags, " "))
+	for _, w := range words {
+		if !strings.Contains(text, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// removeString returns copy of the list without given value.
+func removeString(list []string, val string) []string {
+	out := []string{}
+	for _, v := range list {
+		if v != val {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/user"
 	"path"
 	"strconv"
 	"strings"
@@ -39,6 +40,23 @@ func GetSimpleNoteTimestamp(d string) int64 {
 	return int64(i)
 }
 
+// SimpleNoteTimestamp formats time the same way SimpleNote formats date fields.
+func SimpleNoteTimestamp(t time.Time) string {
+	return fmt.Sprintf("%d.%06d", t.Unix(), t.Nanosecond()/1000)
+}
+
+// ExpandPath replaces leading tilde in the path with user home directory.
+func ExpandPath(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	usr, err := user.Current()
+	if err != nil {
+		return p
+	}
+	return path.Join(usr.HomeDir, strings.TrimPrefix(p, "~"))
+}
+
 // Check if value is in array.
 func CheckIn(needle string, haystack []string) bool {
 	for _, v := range haystack {
@@ -111,3 +129,36 @@ func WriteToFile(prevContent string) (content string, err error) {
 	}
 	return string(c), nil
 }
+
+// EditDistance returns number of single character insertions, deletions, substitutions
+// and transpositions of adjacent characters needed to change one string into another.
+func EditDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = d[i-1][j] + 1
+			if d[i][j-1]+1 < d[i][j] {
+				d[i][j] = d[i][j-1] + 1
+			}
+			if d[i-1][j-1]+cost < d[i][j] {
+				d[i][j] = d[i-1][j-1] + cost
+			}
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}